@@ -0,0 +1,571 @@
+package ranker
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+const (
+	aofOpSet    byte = 'S' // Record payload: key and new value
+	aofOpDelete byte = 'D' // Record payload: key only
+	aofOpIncr   byte = 'I' // Record payload: key and float64 delta
+
+	defaultRewriteMinSize    = 64 << 20 // Don't rewrite files smaller than this
+	defaultRewritePercentage = 100      // Rewrite once the file doubled since the last rewrite
+)
+
+var (
+	errAOFRecord   = errors.New("malformed append-only file record")
+	errAOFChecksum = errors.New("append-only file record checksum mismatch")
+)
+
+// FsyncPolicy decides when appended records are forced to disk.
+type FsyncPolicy int
+
+const (
+	FsyncEverySec FsyncPolicy = iota // Sync once per second in the background, losing at most a second of writes
+	FsyncAlways                      // Sync after every write before it returns
+	FsyncNo                          // Leave syncing to the operating system
+)
+
+// AOFOption configures an AOFStore.
+type AOFOption func(*AOFStore)
+
+// Configures when appended records are synced to disk, FsyncEverySec by default.
+func WithFsync(policy FsyncPolicy) AOFOption {
+	return func(s *AOFStore) {
+		s.fsync = policy
+	}
+}
+
+// Configures automatic rewrites: the file is compacted once it is at least
+// minSize bytes and has grown by percentage since the last rewrite. A
+// percentage of 0 disables automatic rewrites.
+func WithRewriteThreshold(minSize int64, percentage int) AOFOption {
+	return func(s *AOFStore) {
+		s.rewriteMinSize = minSize
+		s.rewritePercentage = percentage
+	}
+}
+
+// Configures the logger receiving rewrite events, including failures of
+// automatic rewrites, which have no caller to return them to. WithAOF
+// passes the Ranker's logger.
+func WithAOFLogger(logger *slog.Logger) AOFOption {
+	return func(s *AOFStore) {
+		if logger != nil {
+			s.logger = logger
+		}
+	}
+}
+
+// AOFStore is a Store that appends every write to a single log file and
+// keeps the current state in memory, similar in spirit to the Redis AOF.
+// Opening the store replays the log, so the whole leaderboard ships as one
+// file. The log is rewritten in the background into one set record per
+// live key once it has grown enough, see WithRewriteThreshold.
+//
+// Each record is framed as a little-endian uint32 CRC-32C of the payload,
+// a uint32 payload length and the payload: an op byte, the uvarint key
+// length, the key and, for sets, the value, for increments the delta as a
+// float64. A torn record at the end of the file, as left by a crash
+// mid-write, is cut off when the store is opened; a damaged record anywhere
+// else fails the open.
+type AOFStore struct {
+	mu   sync.Mutex // Serializes appends and guards the fields below
+	path string
+	f    *os.File
+	size int64
+	mem  *MemoryStore
+
+	fsync FsyncPolicy
+	dirty bool // Records were appended since the last sync
+
+	rewriteMinSize    int64
+	rewritePercentage int
+	baseSize          int64  // File size right after the last rewrite
+	rewriting         bool   // A rewrite is running
+	rewriteBuf        []byte // Records appended while rewriting
+	generation        int    // Bumped by Truncate so a running rewrite is discarded
+
+	logger *slog.Logger
+
+	done chan struct{}
+	wg   sync.WaitGroup
+}
+
+// Opens or creates the append-only file at path and replays it.
+func OpenAOFStore(path string, opts ...AOFOption) (*AOFStore, error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+	s := &AOFStore{
+		path:              path,
+		f:                 f,
+		mem:               NewMemoryStore(),
+		rewriteMinSize:    defaultRewriteMinSize,
+		rewritePercentage: defaultRewritePercentage,
+		logger:            slog.New(discardHandler{}),
+		done:              make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	valid, err := s.replay()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	if err := f.Truncate(valid); err != nil {
+		f.Close()
+		return nil, err
+	}
+	if _, err := f.Seek(valid, io.SeekStart); err != nil {
+		f.Close()
+		return nil, err
+	}
+	s.size = valid
+	s.baseSize = valid
+
+	if s.fsync == FsyncEverySec {
+		s.wg.Add(1)
+		go s.syncLoop()
+	}
+	return s, nil
+}
+
+// Configures the Ranker to persist into the append-only file at path,
+// opened when the Ranker starts.
+func WithAOF(path string, opts ...AOFOption) Option {
+	return func(r *Ranker) {
+		r.openStore = func() (Store, error) {
+			logger := WithAOFLogger(r.logger.With("component", "aof"))
+			return OpenAOFStore(path, append([]AOFOption{logger}, opts...)...)
+		}
+	}
+}
+
+// Returns the path of the append-only file.
+func (s *AOFStore) Path() string {
+	return s.path
+}
+
+// Applies every record to the in-memory state and returns the offset just
+// past the last one. Only the last record may be damaged, as left by a
+// crash mid-write; it is skipped so the caller cuts it off. A damaged
+// record followed by more data means the file is corrupt, which returns an
+// error naming its offset rather than dropping everything after it.
+func (s *AOFStore) replay() (int64, error) {
+	info, err := s.f.Stat()
+	if err != nil {
+		return 0, err
+	}
+	if _, err := s.f.Seek(0, io.SeekStart); err != nil {
+		return 0, err
+	}
+	br := bufio.NewReader(s.f)
+	size := info.Size()
+	var offset int64
+	var header [8]byte
+	var payload []byte
+	for {
+		remaining := size - offset
+		if remaining < int64(len(header)) {
+			// Nothing left, or a header torn at the end.
+			return offset, nil
+		}
+		if _, err := io.ReadFull(br, header[:]); err != nil {
+			return 0, err
+		}
+		sum := binary.LittleEndian.Uint32(header[:4])
+		n := int64(binary.LittleEndian.Uint32(header[4:]))
+		end := offset + int64(len(header)) + n
+		if end > size {
+			// The payload was torn at the end.
+			return offset, nil
+		}
+		if cap(payload) < int(n) {
+			payload = make([]byte, n)
+		}
+		payload = payload[:n]
+		if _, err := io.ReadFull(br, payload); err != nil {
+			return 0, err
+		}
+		var kind byte
+		var op batchOp
+		err := errAOFChecksum
+		if crc32.Checksum(payload, crcTable) == sum {
+			kind, op, err = decodeAOFRecord(payload)
+		}
+		if err != nil {
+			if end == size {
+				return offset, nil
+			}
+			return 0, fmt.Errorf("%w at offset %d of %s", err, offset, s.path)
+		}
+		if kind == aofOpIncr {
+			op.value = float64ToBytes(s.current(op.key) + bytesToFloat64(op.value))
+		}
+		s.mem.apply([]batchOp{op})
+		offset = end
+	}
+}
+
+// Returns the score stored under key, 0 when missing.
+func (s *AOFStore) current(key []byte) float64 {
+	value, err := s.mem.Get(key)
+	if err != nil || len(value) != 8 {
+		return 0
+	}
+	return bytesToFloat64(value)
+}
+
+// Appends a framed record to buf.
+func appendAOFRecord(buf []byte, kind byte, key, value []byte) []byte {
+	start := len(buf)
+	buf = append(buf, make([]byte, 8)...)
+	buf = append(buf, kind)
+	buf = binary.AppendUvarint(buf, uint64(len(key)))
+	buf = append(buf, key...)
+	buf = append(buf, value...)
+
+	payload := buf[start+8:]
+	binary.LittleEndian.PutUint32(buf[start:], crc32.Checksum(payload, crcTable))
+	binary.LittleEndian.PutUint32(buf[start+4:], uint32(len(payload)))
+	return buf
+}
+
+// Appends the framed record of a set or delete to buf.
+func appendAOFOp(buf []byte, op batchOp) []byte {
+	if op.delete {
+		return appendAOFRecord(buf, aofOpDelete, op.key, nil)
+	}
+	return appendAOFRecord(buf, aofOpSet, op.key, op.value)
+}
+
+// Decodes a record payload. For increments the op value holds the delta.
+func decodeAOFRecord(payload []byte) (byte, batchOp, error) {
+	if len(payload) < 2 {
+		return 0, batchOp{}, errAOFRecord
+	}
+	kind := payload[0]
+	n, size := binary.Uvarint(payload[1:])
+	if size <= 0 || uint64(len(payload)-1-size) < n {
+		return 0, batchOp{}, errAOFRecord
+	}
+	rest := payload[1+size:]
+	op := batchOp{key: append([]byte(nil), rest[:n]...)}
+	switch kind {
+	case aofOpSet:
+		op.value = append([]byte(nil), rest[n:]...)
+	case aofOpIncr:
+		if len(rest[n:]) != 8 {
+			return 0, batchOp{}, errAOFRecord
+		}
+		op.value = append([]byte(nil), rest[n:]...)
+	case aofOpDelete:
+		op.delete = true
+	default:
+		return 0, batchOp{}, errAOFRecord
+	}
+	return kind, op, nil
+}
+
+// Writes encoded records to the file, the caller holds the lock.
+func (s *AOFStore) append(buf []byte) error {
+	if s.f == nil {
+		return ErrStoreClosed
+	}
+	if _, err := s.f.Write(buf); err != nil {
+		return err
+	}
+	s.size += int64(len(buf))
+	if s.rewriting {
+		s.rewriteBuf = append(s.rewriteBuf, buf...)
+	}
+
+	switch s.fsync {
+	case FsyncAlways:
+		if err := s.f.Sync(); err != nil {
+			return err
+		}
+	case FsyncEverySec:
+		s.dirty = true
+	}
+
+	if s.shouldRewrite() {
+		s.rewriting = true
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			if err := s.rewrite(); err != nil {
+				s.logger.Error("aof rewrite failed", "path", s.path, "err", err)
+			}
+		}()
+	}
+	return nil
+}
+
+// Reports whether the file has grown enough for an automatic rewrite.
+func (s *AOFStore) shouldRewrite() bool {
+	if s.rewriting || s.rewritePercentage <= 0 || s.size < s.rewriteMinSize {
+		return false
+	}
+	return s.size >= s.baseSize+s.baseSize*int64(s.rewritePercentage)/100
+}
+
+// Appends the records of ops with a single write, then applies them.
+func (s *AOFStore) apply(ops []batchOp) error {
+	var buf []byte
+	for _, op := range ops {
+		buf = appendAOFOp(buf, op)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.append(buf); err != nil {
+		return err
+	}
+	return s.mem.apply(ops)
+}
+
+func (s *AOFStore) Get(key []byte) ([]byte, error) {
+	return s.mem.Get(key)
+}
+
+func (s *AOFStore) Set(key, value []byte) error {
+	return s.apply([]batchOp{{key: key, value: value}})
+}
+
+func (s *AOFStore) Delete(key []byte) error {
+	return s.apply([]batchOp{{key: key, delete: true}})
+}
+
+// Logs an increment record and returns the new score.
+func (s *AOFStore) Incr(key []byte, delta float64) (float64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	score := s.current(key) + delta
+	if err := s.append(appendAOFRecord(nil, aofOpIncr, key, float64ToBytes(delta))); err != nil {
+		return 0, err
+	}
+	return score, s.mem.Set(key, float64ToBytes(score))
+}
+
+func (s *AOFStore) NewBatch() Batch {
+	return &memoryBatch{apply: s.apply}
+}
+
+func (s *AOFStore) Iterate(lower, upper []byte, fn func(key, value []byte) error) error {
+	return s.mem.Iterate(lower, upper, fn)
+}
+
+// Syncs records appended since the last sync.
+func (s *AOFStore) Sync() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.f == nil {
+		return ErrStoreClosed
+	}
+	s.dirty = false
+	return s.f.Sync()
+}
+
+// Syncs once per second while there are unsynced records.
+func (s *AOFStore) syncLoop() {
+	defer s.wg.Done()
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-ticker.C:
+			s.mu.Lock()
+			if s.dirty && s.f != nil {
+				s.f.Sync()
+				s.dirty = false
+			}
+			s.mu.Unlock()
+		}
+	}
+}
+
+// Compacts the file into one set record per live key.
+//
+// The current state is copied under the lock and written to a temporary
+// file without it, while new records keep going to the old file and are
+// also collected in rewriteBuf. Finally, under the lock again, the collected
+// records are appended to the new file, which then replaces the old one.
+func (s *AOFStore) Rewrite() error {
+	s.mu.Lock()
+	if s.f == nil {
+		s.mu.Unlock()
+		return ErrStoreClosed
+	}
+	if s.rewriting {
+		s.mu.Unlock()
+		return nil
+	}
+	s.rewriting = true
+	s.mu.Unlock()
+	return s.rewrite()
+}
+
+// Runs a rewrite, the caller has set rewriting. After a failure the next
+// automatic rewrite waits for the file to grow by the threshold again.
+func (s *AOFStore) rewrite() (err error) {
+	s.mu.Lock()
+	ops := s.mem.snapshot()
+	generation := s.generation
+	s.rewriteBuf = nil
+	s.mu.Unlock()
+
+	tmp := s.path + ".rewrite"
+	err = writeAOFSnapshot(tmp, ops)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	defer func() {
+		s.rewriting = false
+		s.rewriteBuf = nil
+		if err != nil {
+			s.baseSize = s.size
+		}
+	}()
+	if err == nil && s.f == nil {
+		err = ErrStoreClosed
+	}
+	if err == nil && s.generation != generation {
+		// Truncated meanwhile, the snapshot no longer applies.
+		os.Remove(tmp)
+		return nil
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+
+	f, err := os.OpenFile(tmp, os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	if _, err := f.Write(s.rewriteBuf); err != nil {
+		f.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		os.Remove(tmp)
+		return err
+	}
+	size, err := f.Seek(0, io.SeekEnd)
+	if err != nil {
+		f.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := os.Rename(tmp, s.path); err != nil {
+		f.Close()
+		os.Remove(tmp)
+		return err
+	}
+	syncDir(filepath.Dir(s.path))
+
+	s.f.Close()
+	s.f = f
+	s.size = size
+	s.baseSize = size
+	s.dirty = false
+	s.logger.Info("aof rewritten", "path", s.path, "bytes", size)
+	return nil
+}
+
+// Writes one set record per op into a new synced file.
+func writeAOFSnapshot(path string, ops []batchOp) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	bw := bufio.NewWriter(f)
+	var buf []byte
+	for _, op := range ops {
+		buf = appendAOFOp(buf[:0], op)
+		if _, err := bw.Write(buf); err != nil {
+			f.Close()
+			return err
+		}
+	}
+	if err := bw.Flush(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// Stops background work, syncs and closes the file.
+func (s *AOFStore) Close() error {
+	s.mu.Lock()
+	if s.f == nil {
+		s.mu.Unlock()
+		return nil
+	}
+	close(s.done)
+	s.mu.Unlock()
+	s.wg.Wait()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	err := s.f.Sync()
+	if cerr := s.f.Close(); err == nil {
+		err = cerr
+	}
+	s.f = nil
+	s.mem.Close()
+	return err
+}
+
+// Empties the file and the in-memory state.
+func (s *AOFStore) Truncate() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.f == nil {
+		return ErrStoreClosed
+	}
+	if err := s.f.Truncate(0); err != nil {
+		return err
+	}
+	if _, err := s.f.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	s.size = 0
+	s.baseSize = 0
+	s.rewriteBuf = nil
+	s.generation++
+	return s.mem.Truncate()
+}
+
+// Returns the size of the append-only file.
+func (s *AOFStore) DiskUsage() uint64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return uint64(s.size)
+}
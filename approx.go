@@ -0,0 +1,470 @@
+package ranker
+
+import (
+	"context"
+	"math"
+	"math/rand"
+	"sync"
+)
+
+// Configures approximate ranking for very large boards: only the best
+// headSize players are kept in the ZSet and ranked exactly, everyone else is
+// counted in a histogram of scores and ranked within the bounds of their
+// bucket, see Entry.Error. Buckets span a relative score range of
+// 2^-precision, so higher precision means smaller errors and more buckets;
+// precision is clamped to 1..52.
+//
+// Scores of players outside the head are read from the store, so this mode
+// needs a persistent store and doesn't combine with WithoutPersistence.
+// Range, Export and Check only cover the head, CountByScore and CountAbove
+// are approximate, and Start always loads synchronously. Replication and
+// Cluster snapshots only carry the head, so they don't combine with this
+// mode either.
+func WithApproximateRanks(headSize, precision int) Option {
+	return func(r *Ranker) {
+		ctx, cancel := context.WithCancel(context.Background())
+		r.approx = &approxRanks{
+			headSize: max(headSize, 0),
+			hist:     newScoreHistogram(uint(min(max(precision, 1), 52))),
+			ctx:      ctx,
+			cancel:   cancel,
+		}
+	}
+}
+
+// approxRanks holds the state of approximate ranking. Every head member's
+// bucket is above every non-empty histogram bucket, which keeps head ranks
+// exact; the head refills from the top buckets in the background once
+// removals drain it.
+type approxRanks struct {
+	headSize int
+	hist     *scoreHistogram
+
+	refilling bool               // Set while a refill runs
+	refills   sync.WaitGroup     // Tracks the refill
+	ctx       context.Context    // Stops the refill once done
+	cancel    context.CancelFunc // Called by Close
+}
+
+// Stops a running refill and waits for it.
+func (a *approxRanks) stopRefill() {
+	a.cancel()
+	a.refills.Wait()
+}
+
+// Reports whether a score belongs in the head.
+func (a *approxRanks) inHead(score float64) bool {
+	top, ok := a.hist.top()
+	return !ok || a.hist.bucket(score) > top
+}
+
+// Adds a player that is in neither the head nor the histogram, the caller
+// holds the lock.
+func (r *Ranker) approxInsert(playerID string, score float64) error {
+	a := r.approx
+	if !a.inHead(score) {
+		a.hist.add(score, 1)
+		return nil
+	}
+	if err := r.zadd(playerID, score); err != nil {
+		return err
+	}
+	if r.zset.ZCard() <= a.headSize {
+		return nil
+	}
+
+	// Move the lowest member to the histogram, along with any member
+	// sharing its bucket.
+	x, _ := r.zset.ZPopMin()
+	a.hist.add(x.score, 1)
+	top := a.hist.bucket(x.score)
+	for r.zset.ZCard() > 0 {
+		lowest := r.zset.zset.zsl.head.level[0].forward
+		if a.hist.bucket(lowest.score) > top {
+			break
+		}
+		r.zset.ZRem(lowest.member)
+		a.hist.add(lowest.score, 1)
+	}
+	return nil
+}
+
+// Removes a player with its current score, the caller holds the lock.
+func (r *Ranker) approxRemove(playerID string, score float64) {
+	if r.zset.ZRem(playerID) != nil {
+		r.approx.hist.add(score, -1)
+	}
+}
+
+// Writes a score to the store and moves the player, the caller holds the lock.
+func (r *Ranker) approxSet(playerID string, score float64) error {
+	old, err := r.score(playerID)
+	if err != nil && err != ErrKeyNotExist {
+		return err
+	}
+	exists := err == nil
+	if err := r.store.Set(unsafeStringToBytes(playerID), float64ToBytes(score)); err != nil {
+		return err
+	}
+	if exists {
+		r.approxRemove(playerID, old)
+	}
+	if err := r.approxInsert(playerID, score); err != nil {
+		return err
+	}
+	r.approxRefill()
+	return nil
+}
+
+// Returns the lowest histogram bucket to refill the head from once removals
+// have drained it to half its size, the caller holds the lock.
+func (r *Ranker) approxCutoff() (uint64, bool) {
+	a := r.approx
+	missing := a.headSize - r.zset.ZCard()
+	if missing <= 0 || missing < a.headSize/2 {
+		return 0, false
+	}
+	return a.hist.cutoff(int64(missing))
+}
+
+// Starts refilling the head in the background if it needs it, the caller
+// holds the lock.
+func (r *Ranker) approxRefill() {
+	a := r.approx
+	if a.refilling || a.ctx.Err() != nil {
+		return
+	}
+	if _, ok := r.approxCutoff(); !ok {
+		return
+	}
+	a.refilling = true
+	a.refills.Add(1)
+	go r.approxRefillLoop()
+}
+
+// Refills the head from the top buckets of the histogram. The players in
+// those buckets are only known to the store, so the store is scanned without
+// the lock and the players found are checked against the board before they
+// move, rescanning when writes meanwhile made the scan incomplete. Whole
+// buckets move, keeping every head member above the histogram.
+func (r *Ranker) approxRefillLoop() {
+	a := r.approx
+	defer a.refills.Done()
+	for {
+		r.mu.RLock()
+		hist, store := a.hist, r.store
+		cut, ok := r.approxCutoff()
+		r.mu.RUnlock()
+
+		var found []loadItem
+		err := a.ctx.Err()
+		if ok && err == nil {
+			n := 0
+			err = store.Iterate(nil, nil, func(key, value []byte) error {
+				n++
+				if err := checkCanceled(a.ctx, n); err != nil {
+					return err
+				}
+				if score := bytesToFloat64(value); hist.bucket(score) >= cut {
+					found = append(found, loadItem{member: string(key), score: score})
+				}
+				return nil
+			})
+		}
+
+		r.mu.Lock()
+		done := true
+		// A board rebuilt meanwhile drops the scan, the next write starts over.
+		if ok && err == nil && a.hist == hist {
+			done, err = r.approxMerge(cut, found)
+		}
+		if done {
+			a.refilling = false
+		}
+		r.mu.Unlock()
+		if err != nil && err != context.Canceled {
+			r.logger.Warn("failed to refill approximate head", "id", r.ID, "err", err)
+		}
+		if done {
+			return
+		}
+	}
+}
+
+// Moves the players a refill scan found into the head, if they are still
+// all the histogram holds from the buckets due now. Reports false when the
+// store has to be scanned again. The caller holds the lock.
+func (r *Ranker) approxMerge(scanned uint64, found []loadItem) (bool, error) {
+	a := r.approx
+	cut, ok := r.approxCutoff()
+	if !ok {
+		return true, nil
+	}
+	if cut < scanned {
+		return false, nil
+	}
+	moving := found[:0]
+	for _, item := range found {
+		if a.hist.bucket(item.score) < cut {
+			continue
+		}
+		if _, ok := r.zset.zset.dict[item.member]; ok {
+			continue
+		}
+		value, err := r.store.Get(unsafeStringToBytes(item.member))
+		if err == ErrKeyNotExist {
+			continue
+		}
+		if err != nil {
+			return true, err
+		}
+		if bytesToFloat64(value) == item.score {
+			moving = append(moving, item)
+		}
+	}
+	if int64(len(moving)) != a.hist.total-a.hist.below(cut) {
+		return false, nil
+	}
+	for _, item := range moving {
+		a.hist.add(item.score, -1)
+		if _, err := r.zset.ZAdd(item.score, item.member); err != nil {
+			return true, err
+		}
+	}
+	return true, nil
+}
+
+// Ranks a player outside the head within its bucket, the caller holds the lock.
+func (r *Ranker) approxRank(playerID string) (*Entry, error) {
+	value, err := r.store.Get(unsafeStringToBytes(playerID))
+	if err != nil {
+		return nil, err
+	}
+	score := bytesToFloat64(value)
+	b := r.approx.hist.bucket(score)
+	// The others in the bucket may all be ahead or all behind.
+	spread := int(r.approx.hist.count(b) - 1)
+	ahead := r.zset.ZCard() + int(r.approx.hist.above(b))
+	return &Entry{
+		Rank:  ahead + spread/2,
+		Score: score,
+		Key:   playerID,
+		Error: spread - spread/2,
+	}, nil
+}
+
+// Estimates the histogram players ranked ahead of a score, counting half of
+// its own bucket.
+func (a *approxRanks) countAbove(score float64) int {
+	b := a.hist.bucket(score)
+	return int(a.hist.above(b) + a.hist.count(b)/2)
+}
+
+// Counts the histogram players in the buckets covering [min, max].
+func (a *approxRanks) countByScore(min, max float64) int {
+	if max < min {
+		return 0
+	}
+	return int(a.hist.between(a.hist.bucket(min), a.hist.bucket(max)))
+}
+
+// Reads every stored record into the head and the histogram, without ever
+// holding more than the head in the ZSet. The caller holds the lock.
+func (r *Ranker) loadApprox(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	r.zset = NewZSet()
+	r.approx.hist = newScoreHistogram(r.approx.hist.precision)
+	n := 0
+	return r.store.Iterate(nil, nil, func(key, value []byte) error {
+		n++
+		if err := checkCanceled(ctx, n); err != nil {
+			return err
+		}
+		return r.approxInsert(string(key), bytesToFloat64(value))
+	})
+}
+
+// Splits a complete set into the head and the histogram, the caller holds
+// the lock.
+func (r *Ranker) approxFill(z *ZSet) {
+	r.zset = NewZSet()
+	r.approx.hist = newScoreHistogram(r.approx.hist.precision)
+	for x := z.zset.zsl.tail; x != nil; x = x.backward {
+		r.approxInsert(x.member, x.score)
+	}
+}
+
+// scoreHistogram counts scores in buckets of equal relative width. The
+// buckets ever used are kept in a treap ordered by key, each node summing
+// the counts below it, so adding a bucket and prefix counts take O(log B).
+type scoreHistogram struct {
+	precision uint // Significand bits kept in a bucket key
+	root      *histNode
+	total     int64
+}
+
+// histNode is a bucket of the treap.
+type histNode struct {
+	key         uint64
+	count       int64
+	sum         int64 // Count of the subtree
+	priority    uint32
+	left, right *histNode
+}
+
+func newScoreHistogram(precision uint) *scoreHistogram {
+	return &scoreHistogram{precision: precision}
+}
+
+func (n *histNode) subtotal() int64 {
+	if n == nil {
+		return 0
+	}
+	return n.sum
+}
+
+// Maps a score to its bucket key, preserving order: the float bits are
+// flipped so they sort like the scores, then the low significand bits are
+// dropped.
+func (h *scoreHistogram) bucket(score float64) uint64 {
+	b := math.Float64bits(score)
+	if b>>63 == 1 {
+		b = ^b
+	} else {
+		b |= 1 << 63
+	}
+	return b >> (52 - h.precision)
+}
+
+// Adds delta to the count of the bucket holding score.
+func (h *scoreHistogram) add(score float64, delta int64) {
+	h.root = h.insert(h.root, h.bucket(score), delta)
+	h.total += delta
+}
+
+// Adds delta to bucket b in the subtree n, creating the bucket if needed,
+// and returns the new root of the subtree.
+func (h *scoreHistogram) insert(n *histNode, b uint64, delta int64) *histNode {
+	if n == nil {
+		return &histNode{key: b, count: delta, sum: delta, priority: rand.Uint32()}
+	}
+	n.sum += delta
+	switch {
+	case b < n.key:
+		n.left = h.insert(n.left, b, delta)
+		if n.left.priority > n.priority {
+			return n.rotateRight()
+		}
+	case b > n.key:
+		n.right = h.insert(n.right, b, delta)
+		if n.right.priority > n.priority {
+			return n.rotateLeft()
+		}
+	default:
+		n.count += delta
+	}
+	return n
+}
+
+func (n *histNode) rotateRight() *histNode {
+	l := n.left
+	n.left, l.right = l.right, n
+	l.sum, n.sum = n.sum, n.sum-l.count-l.left.subtotal()
+	return l
+}
+
+func (n *histNode) rotateLeft() *histNode {
+	r := n.right
+	n.right, r.left = r.left, n
+	r.sum, n.sum = n.sum, n.sum-r.count-r.right.subtotal()
+	return r
+}
+
+// Returns the total count of buckets below b.
+func (h *scoreHistogram) below(b uint64) int64 {
+	var sum int64
+	for n := h.root; n != nil; {
+		if b <= n.key {
+			n = n.left
+		} else {
+			sum += n.left.subtotal() + n.count
+			n = n.right
+		}
+	}
+	return sum
+}
+
+// Returns the count of bucket b.
+func (h *scoreHistogram) count(b uint64) int64 {
+	for n := h.root; n != nil; {
+		switch {
+		case b < n.key:
+			n = n.left
+		case b > n.key:
+			n = n.right
+		default:
+			return n.count
+		}
+	}
+	return 0
+}
+
+// Returns the count of all buckets above b.
+func (h *scoreHistogram) above(b uint64) int64 {
+	return h.total - h.below(b) - h.count(b)
+}
+
+// Returns the count of buckets lo to hi inclusive.
+func (h *scoreHistogram) between(lo, hi uint64) int64 {
+	return h.total - h.below(lo) - h.above(hi)
+}
+
+// Returns the highest non-empty bucket.
+func (h *scoreHistogram) top() (uint64, bool) {
+	if h.total == 0 {
+		return 0, false
+	}
+	n := h.root
+	for {
+		switch {
+		case n.right.subtotal() > 0:
+			n = n.right
+		case n.count > 0:
+			return n.key, true
+		default:
+			n = n.left
+		}
+	}
+}
+
+// Returns the lowest bucket such that the buckets from it up hold at most
+// limit players, or just the highest non-empty bucket if that alone holds
+// more.
+func (h *scoreHistogram) cutoff(limit int64) (uint64, bool) {
+	cut, ok := h.top()
+	if !ok {
+		return 0, false
+	}
+	var taken int64
+	var walk func(n *histNode) bool
+	walk = func(n *histNode) bool {
+		if n == nil {
+			return true
+		}
+		if !walk(n.right) {
+			return false
+		}
+		if n.count > 0 {
+			if taken > 0 && taken+n.count > limit {
+				return false
+			}
+			taken += n.count
+			cut = n.key
+		}
+		return walk(n.left)
+	}
+	walk(h.root)
+	return cut, true
+}
@@ -0,0 +1,278 @@
+package ranker
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Checks every rank of an approximate Ranker against the exact reference.
+func assertApprox(t *testing.T, r *Ranker, ref *ZSet, headSize int) {
+	assert.Equal(t, ref.ZCard(), r.Count())
+	head := 0
+	for _, item := range mustRange(ref) {
+		key := item.Member.(string)
+		entry, err := r.Rank(key)
+		assert.NoError(t, err)
+		exact, _ := ref.ZRevRank(key)
+		assert.Equal(t, item.Score, entry.Score)
+		assert.LessOrEqual(t, abs(entry.Rank-int(exact)), entry.Error, key)
+		if entry.Error == 0 && int(exact) < headSize {
+			head++
+		}
+	}
+	assert.LessOrEqual(t, r.zset.ZCard(), headSize)
+	assert.Greater(t, head, 0)
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
+
+func TestRanker_ApproximateRanks(t *testing.T) {
+	store := NewMemoryStore()
+	r := New(WithStore(store), WithApproximateRanks(100, 6))
+	assert.NoError(t, r.Start())
+	ref := NewZSet()
+	rnd := rand.New(rand.NewSource(1))
+	for i := 0; i < 5000; i++ {
+		key := fmt.Sprintf("p%04d", i)
+		score := float64(rnd.Intn(100000))
+		assert.NoError(t, r.Update(key, score))
+		ref.ZAdd(score, key)
+	}
+	assertApprox(t, r, ref, 100)
+
+	// The head stays exact.
+	top, err := r.Range(0, 9)
+	assert.NoError(t, err)
+	items, _ := ref.ZRevRangeWithScores(0, 9)
+	for i, item := range items {
+		assert.Equal(t, item.Member, top[i].Key)
+		assert.Equal(t, 0, top[i].Error)
+	}
+
+	// Moves between the head and the tail, and removals.
+	for i := 0; i < 2000; i++ {
+		key := fmt.Sprintf("p%04d", rnd.Intn(5000))
+		switch rnd.Intn(3) {
+		case 0:
+			score := float64(rnd.Intn(100000))
+			assert.NoError(t, r.Update(key, score))
+			ref.ZAdd(score, key)
+		case 1:
+			_, err := r.IncrBy(key, 50000)
+			assert.NoError(t, err)
+			score, _ := ref.ZScore(key) // A missing player counts as 0
+			ref.ZAdd(score+50000, key)
+		case 2:
+			if r.Remove(key) == nil {
+				ref.ZRem(key)
+			}
+		}
+	}
+	assertApprox(t, r, ref, 100)
+	assert.NoError(t, r.Verify())
+
+	_, err = r.Rank("missing")
+	assert.ErrorIs(t, err, ErrKeyNotExist)
+
+	// Reloading from the store rebuilds the head and the histogram.
+	assert.NoError(t, r.loadApprox(context.Background()))
+	assertApprox(t, r, ref, 100)
+}
+
+func TestRanker_ApproximateCounts(t *testing.T) {
+	r := New(WithStore(NewMemoryStore()), WithApproximateRanks(10, 52))
+	assert.NoError(t, r.Start())
+	defer r.Close()
+	for i := 0; i < 100; i++ {
+		assert.NoError(t, r.Update(fmt.Sprintf("p%02d", i), float64(i)))
+	}
+
+	// With every significand bit kept, buckets hold a single score.
+	count, err := r.CountByScore(20, 59)
+	assert.NoError(t, err)
+	assert.Equal(t, 40, count)
+	count, err = r.CountAbove(49.5, "")
+	assert.NoError(t, err)
+	assert.Equal(t, 50, count)
+	entry, err := r.Rank("p30")
+	assert.NoError(t, err)
+	assert.Equal(t, &Entry{Rank: 69, Score: 30, Key: "p30"}, entry)
+
+	assert.ErrorIs(t, New(WithoutPersistence(), WithApproximateRanks(10, 8)).Start(), ErrInvalidParams)
+}
+
+func TestScoreHistogram(t *testing.T) {
+	h := newScoreHistogram(4)
+	for _, score := range []float64{-3, -1, 0, 1, 1.01, 2, 100, 100} {
+		h.add(score, 1)
+	}
+	assert.Equal(t, int64(2), h.count(h.bucket(1)))
+	assert.Equal(t, int64(3), h.above(h.bucket(1)))
+	assert.Equal(t, int64(5), h.between(h.bucket(-1), h.bucket(2)))
+	top, ok := h.top()
+	assert.True(t, ok)
+	assert.Equal(t, h.bucket(100), top)
+
+	h.add(100, -2)
+	top, _ = h.top()
+	assert.Equal(t, h.bucket(2), top)
+	assert.Less(t, h.bucket(-3), h.bucket(-1))
+	assert.Less(t, h.bucket(-1), h.bucket(0))
+
+	// Whole buckets from the top, at least the highest one.
+	cut, ok := h.cutoff(3)
+	assert.True(t, ok)
+	assert.Equal(t, h.bucket(1), cut)
+	cut, _ = h.cutoff(0)
+	assert.Equal(t, h.bucket(2), cut)
+	_, ok = newScoreHistogram(4).cutoff(10)
+	assert.False(t, ok)
+}
+
+func TestScoreHistogram_Random(t *testing.T) {
+	h := newScoreHistogram(52)
+	counts := map[uint64]int64{}
+	rnd := rand.New(rand.NewSource(1))
+	for i := 0; i < 10000; i++ {
+		score := float64(rnd.Intn(2000) - 1000)
+		delta := int64(1)
+		if b := h.bucket(score); counts[b] > 0 && rnd.Intn(3) == 0 {
+			delta = -1
+		}
+		h.add(score, delta)
+		counts[h.bucket(score)] += delta
+	}
+
+	var total int64
+	for _, c := range counts {
+		total += c
+	}
+	assert.Equal(t, total, h.total)
+	for i := 0; i < 100; i++ {
+		lo := h.bucket(float64(rnd.Intn(2200) - 1100))
+		hi := h.bucket(float64(rnd.Intn(2200) - 1100))
+		if hi < lo {
+			lo, hi = hi, lo
+		}
+		var above, between int64
+		for b, c := range counts {
+			if b > lo {
+				above += c
+			}
+			if b >= lo && b <= hi {
+				between += c
+			}
+		}
+		assert.Equal(t, counts[lo], h.count(lo))
+		assert.Equal(t, above, h.above(lo))
+		assert.Equal(t, between, h.between(lo, hi))
+	}
+}
+
+// Waits until no refill is running.
+func waitRefill(t *testing.T, r *Ranker) {
+	assert.Eventually(t, func() bool {
+		r.mu.RLock()
+		defer r.mu.RUnlock()
+		return !r.approx.refilling
+	}, 5*time.Second, time.Millisecond)
+}
+
+// heldStore holds the first Iterate once hold is set, after it has taken its
+// snapshot, until hold is closed. entered is closed once it is held.
+type heldStore struct {
+	*MemoryStore
+	once    sync.Once
+	hold    chan struct{}
+	entered chan struct{}
+}
+
+func (s *heldStore) Iterate(lower, upper []byte, fn func(key, value []byte) error) error {
+	return s.MemoryStore.Iterate(lower, upper, func(key, value []byte) error {
+		if s.hold != nil {
+			s.once.Do(func() {
+				close(s.entered)
+				<-s.hold
+			})
+		}
+		return fn(key, value)
+	})
+}
+
+func TestRanker_ApproximateRefill(t *testing.T) {
+	r := New(WithStore(NewMemoryStore()), WithApproximateRanks(10, 52))
+	assert.NoError(t, r.Start())
+	defer r.Close()
+	for i := 0; i < 100; i++ {
+		assert.NoError(t, r.Update(fmt.Sprintf("p%02d", i), float64(i)))
+	}
+
+	// Draining the head below half its size pulls the next players in.
+	for i := 99; i > 94; i-- {
+		assert.NoError(t, r.Remove(fmt.Sprintf("p%02d", i)))
+	}
+	waitRefill(t, r)
+	assert.Equal(t, 10, r.zset.ZCard())
+	assert.Equal(t, 85, int(r.approx.hist.total))
+	entry, err := r.Rank("p85")
+	assert.NoError(t, err)
+	assert.Equal(t, &Entry{Rank: 9, Score: 85, Key: "p85"}, entry)
+	assert.NoError(t, r.Verify())
+}
+
+func TestRanker_ApproximateRetry(t *testing.T) {
+	dir := t.TempDir()
+	makeStore(t, dir, 5000)
+
+	// A failed load leaves ready open, so a retried Start can close it.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	r := New(WithStorageDir(dir), WithApproximateRanks(100, 6))
+	assert.ErrorIs(t, r.StartContext(ctx), context.Canceled)
+	assert.NoError(t, r.Start())
+	defer r.Close()
+	<-r.Ready()
+	assert.Equal(t, 5000, r.Count())
+}
+
+func TestRanker_ApproximateRefillWrites(t *testing.T) {
+	store := &heldStore{MemoryStore: NewMemoryStore()}
+	r := New(WithStore(store), WithApproximateRanks(10, 52))
+	assert.NoError(t, r.Start())
+	defer r.Close()
+	for i := 0; i < 100; i++ {
+		assert.NoError(t, r.Update(fmt.Sprintf("p%02d", i), float64(i)))
+	}
+
+	store.hold, store.entered = make(chan struct{}), make(chan struct{})
+	for i := 99; i > 94; i-- {
+		assert.NoError(t, r.Remove(fmt.Sprintf("p%02d", i)))
+	}
+	<-store.entered
+	// Writes go on during the scan, and move players it can't see.
+	assert.NoError(t, r.Update("p10", 88.5))
+	assert.NoError(t, r.Update("p86", 1))
+	close(store.hold)
+	waitRefill(t, r)
+
+	assert.Equal(t, 10, r.zset.ZCard())
+	for _, id := range []string{"p94", "p90", "p89", "p10", "p85"} {
+		_, err := r.zset.ZScore(id)
+		assert.NoError(t, err, id)
+	}
+	entry, err := r.Rank("p10")
+	assert.NoError(t, err)
+	assert.Equal(t, &Entry{Rank: 6, Score: 88.5, Key: "p10"}, entry)
+	assert.NoError(t, r.Verify())
+}
@@ -0,0 +1,141 @@
+package ranker
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"time"
+)
+
+var (
+	ErrWarming = errors.New("ranker is still loading")
+)
+
+// pendingOp is a write accepted while the in-memory set was still loading.
+type pendingOp struct {
+	playerID string
+	score    float64
+	remove   bool
+}
+
+// Configures Start to return immediately and load existing data in the
+// background. Writes are persisted to the store right away and applied to the
+// in-memory set once loading completes; rank queries return ErrWarming
+// until then, while Score answers from the store.
+func WithAsyncStart() Option {
+	return func(r *Ranker) {
+		r.async = true
+	}
+}
+
+// Returns a channel that is closed once the in-memory leaderboard is
+// complete, or Start has failed; see LoadError. A retried Start replaces
+// the channel.
+func (r *Ranker) Ready() <-chan struct{} {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.ready
+}
+
+// Returns the error that stopped the last Start, including a background
+// load, if any.
+func (r *Ranker) LoadError() error {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.loadErr
+}
+
+// Retrieves a player's score, served from the store while warming up.
+func (r *Ranker) Score(playerID string) (float64, error) {
+	return r.ScoreContext(context.Background(), playerID)
+}
+
+// Like Score, with ctx for tracing and cancellation.
+func (r *Ranker) ScoreContext(ctx context.Context, playerID string) (_ float64, err error) {
+	op := r.begin(ctx, opScore, slog.String("player", playerID))
+	defer op.end(&err)
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.score(playerID)
+}
+
+// Looks up a score, the caller holds the lock.
+func (r *Ranker) score(playerID string) (float64, error) {
+	if !r.warming {
+		score, err := r.zset.ZScore(playerID)
+		if err == nil || r.approx == nil {
+			return score, err
+		}
+		// Players outside the approximate head are only in the store.
+	}
+	value, err := r.store.Get(unsafeStringToBytes(playerID))
+	if err != nil {
+		return 0, err
+	}
+	return bytesToFloat64(value), nil
+}
+
+// Buffers a write made while warming for warmUp to replay, the caller
+// holds the lock. Nothing is buffered once the load has failed.
+func (r *Ranker) addPending(op pendingOp) {
+	if r.loadErr == nil {
+		r.pending = append(r.pending, op)
+	}
+}
+
+// Reports why rank queries can't be answered yet, the caller holds the lock.
+func (r *Ranker) checkReady() error {
+	if !r.warming {
+		return nil
+	}
+	if r.loadErr != nil {
+		return r.loadErr
+	}
+	return ErrWarming
+}
+
+// Loads the leaderboard without holding the lock, then applies the writes
+// that arrived meanwhile. Replaying them is safe even when the store
+// iteration already saw them, since each one carries its final state.
+// Replayed updates emit their rank events against the loaded board, so a
+// write the iteration already saw emits none.
+func (r *Ranker) warmUp(ctx context.Context) {
+	defer r.loading.Done()
+	startTime := time.Now()
+	z, err := r.load(ctx)
+
+	r.mu.Lock()
+	if err != nil {
+		// The set is never completed, so the buffered writes are dropped;
+		// they are in the store already.
+		r.loadErr = err
+		r.pending = nil
+	} else {
+		r.zset = z
+		for _, op := range r.pending {
+			if op.remove {
+				z.ZRem(op.playerID)
+			} else {
+				r.zadd(op.playerID, op.score)
+			}
+		}
+		r.pending = nil
+		r.warming = false
+		r.loaded = true
+		r.loadDuration = time.Since(startTime)
+		if err = r.enforceMaxSize(); err != nil {
+			r.loadErr = err
+		}
+	}
+	r.mu.Unlock()
+
+	if err != nil {
+		r.logger.Error("load failed", "id", r.ID, "err", err)
+	} else {
+		r.logLoaded()
+	}
+	close(r.ready)
+}
@@ -0,0 +1,129 @@
+package ranker
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// gatedStore holds the first Iterate, and with it a background load, after
+// it has taken its snapshot until gate is closed, then fails it with err if
+// set. started is closed once the snapshot is taken.
+type gatedStore struct {
+	*MemoryStore
+	once    sync.Once
+	started chan struct{}
+	gate    chan struct{}
+	err     error
+}
+
+func newGatedStore(n int) *gatedStore {
+	s := &gatedStore{MemoryStore: NewMemoryStore(), started: make(chan struct{}), gate: make(chan struct{})}
+	for i := 0; i < n; i++ {
+		s.Set([]byte(strconv.Itoa(i)), float64ToBytes(float64(i)))
+	}
+	return s
+}
+
+func (s *gatedStore) Iterate(lower, upper []byte, fn func(key, value []byte) error) error {
+	first := true
+	return s.MemoryStore.Iterate(lower, upper, func(key, value []byte) error {
+		if first {
+			first = false
+			var err error
+			s.once.Do(func() {
+				close(s.started)
+				<-s.gate
+				err = s.err
+			})
+			if err != nil {
+				return err
+			}
+		}
+		return fn(key, value)
+	})
+}
+
+func TestRanker_AsyncStart(t *testing.T) {
+	store := newGatedStore(10000)
+	var events []RankEvent
+	r := New(WithStore(store), WithAsyncStart(), WithThresholds(1),
+		WithNotifier(func(e []RankEvent) { events = append(events, e...) }))
+	assert.NoError(t, r.Start())
+	defer r.Close()
+	<-store.started
+
+	assert.NoError(t, r.Update("new", 1e6))
+	assert.NoError(t, r.Remove("0"))
+	score, err := r.IncrBy("1", 10)
+	assert.NoError(t, err)
+	assert.Equal(t, float64(11), score)
+	score, err = r.Score("2")
+	assert.NoError(t, err)
+	assert.Equal(t, float64(2), score)
+	_, err = r.Rank("new")
+	assert.ErrorIs(t, err, ErrWarming)
+
+	close(store.gate)
+	<-r.Ready()
+	assert.NoError(t, r.LoadError())
+	assert.Equal(t, 10000, r.Count())
+	entry, err := r.Rank("new")
+	assert.NoError(t, err)
+	assert.Equal(t, 0, entry.Rank)
+	_, err = r.Rank("0")
+	assert.ErrorIs(t, err, ErrKeyNotExist)
+	entry, err = r.Rank("1")
+	assert.NoError(t, err)
+	assert.Equal(t, float64(11), entry.Score)
+	assert.NoError(t, r.Verify())
+
+	// The replayed update took the top spot from the best loaded player, the
+	// load didn't see it.
+	assert.Equal(t, []RankEvent{
+		{Type: Overtook, Member: "new", Other: "9999", Threshold: 1, Rank: 0},
+		{Type: Overtaken, Member: "9999", Other: "new", Threshold: 1, Rank: 1},
+	}, events)
+}
+
+func TestRanker_AsyncStartFailure(t *testing.T) {
+	store := newGatedStore(10)
+	store.err = errors.New("disk on fire")
+	r := New(WithStore(store), WithAsyncStart())
+	assert.NoError(t, r.Start())
+	defer r.Close()
+	<-store.started
+	assert.NoError(t, r.Update("a", 1))
+
+	close(store.gate)
+	<-r.Ready()
+	assert.ErrorIs(t, r.LoadError(), store.err)
+	_, err := r.Rank("a")
+	assert.ErrorIs(t, err, store.err)
+
+	// Writes still reach the store, without piling up in memory.
+	assert.NoError(t, r.Update("b", 2))
+	assert.NoError(t, r.Remove("a"))
+	assert.Empty(t, r.pending)
+	score, err := r.Score("b")
+	assert.NoError(t, err)
+	assert.Equal(t, float64(2), score)
+}
+
+func TestRanker_AsyncStartClose(t *testing.T) {
+	store := newGatedStore(10000)
+	r := New(WithStore(store), WithAsyncStart(), WithLoadConcurrency(1))
+	assert.NoError(t, r.Start())
+	<-store.started
+
+	// Close stops the load instead of waiting for every record.
+	time.AfterFunc(10*time.Millisecond, func() { close(store.gate) })
+	r.Close()
+	assert.ErrorIs(t, r.LoadError(), context.Canceled)
+	assert.False(t, r.loaded)
+}
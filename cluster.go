@@ -0,0 +1,472 @@
+package ranker
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/hashicorp/raft"
+	raftboltdb "github.com/hashicorp/raft-boltdb/v2"
+)
+
+const (
+	defaultApplyTimeout   = 5 * time.Second // How long writes and reads wait for the cluster
+	raftDirSuffix         = ".raft"         // Appended to StorageDir for the default Raft directory
+	raftSnapshotsRetained = 2               // Snapshots kept by the default snapshot store
+)
+
+var (
+	ErrNotLeader = errors.New("not the cluster leader")
+	ErrNotEmpty  = errors.New("ranker holds players outside the cluster")
+)
+
+// raftTermKey is where Raft persists its current term in the stable store,
+// before it acts in that term.
+var raftTermKey = []byte("CurrentTerm")
+
+// ClusterConfig configures a Raft node serving a Ranker.
+type ClusterConfig struct {
+	Raft      *raft.Config // Raft settings, LocalID must be set
+	Transport raft.Transport
+	Logs      raft.LogStore      // Defaults to a BoltDB file in Dir
+	Stable    raft.StableStore   // Defaults to the same BoltDB file as Logs
+	Snapshots raft.SnapshotStore // Defaults to snapshot files in Dir
+	Dir       string             // Directory of the default stores, StorageDir with a ".raft" suffix by default
+	Timeout   time.Duration      // Bounds writes and linearizable reads, 5s by default
+}
+
+// Cluster replicates a Ranker across nodes with Raft. Writes are committed
+// through the replicated log before every node applies them to its store
+// and ZSet in the same order; reads are served by the leader only after it
+// confirmed its leadership and applied every committed write.
+//
+// The Raft log and snapshots are the source of truth: a node restarting
+// with Raft state rebuilds the Ranker from the latest snapshot and the log
+// after it, so the Raft stores must be durable for the board to survive a
+// full restart, as the default ones are. A node without Raft state joins
+// with an empty Ranker, NewCluster returns ErrNotEmpty otherwise rather than
+// dropping players the cluster doesn't know about. Snapshots hold the
+// index of the last applied command followed by the image format the
+// Ranker writes on Close. Writes made directly to the Ranker bypass the
+// cluster and are lost on the next restore. Approximate ranks aren't
+// supported, since images only carry the head.
+type Cluster struct {
+	r       *Ranker
+	fsm     *clusterFSM
+	raft    *raft.Raft
+	logs    raft.LogStore
+	stable  raft.StableStore
+	timeout time.Duration
+	bolt    *raftboltdb.BoltStore // Default log and stable store, nil when both were given
+
+	barrierTerm atomic.Uint64 // Latest term a barrier committed in
+}
+
+// Starts a cluster node serving r, which must be started.
+func NewCluster(r *Ranker, cfg ClusterConfig) (*Cluster, error) {
+	<-r.Ready()
+	if err := r.LoadError(); err != nil {
+		return nil, err
+	}
+	if cfg.Raft == nil || cfg.Transport == nil {
+		return nil, ErrInvalidParams
+	}
+	if r.approx != nil {
+		return nil, ErrNotSupported
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = defaultApplyTimeout
+	}
+	bolt, err := openRaftStores(r, &cfg)
+	if err != nil {
+		return nil, err
+	}
+	closeBolt := func() {
+		if bolt != nil {
+			bolt.Close()
+		}
+	}
+
+	if err := resetForRaft(r, cfg); err != nil {
+		closeBolt()
+		return nil, err
+	}
+	fsm := &clusterFSM{r: r, notify: make(chan struct{})}
+	ra, err := raft.NewRaft(cfg.Raft, fsm, cfg.Logs, cfg.Stable, cfg.Snapshots, cfg.Transport)
+	if err != nil {
+		closeBolt()
+		return nil, err
+	}
+	return &Cluster{
+		r:       r,
+		fsm:     fsm,
+		raft:    ra,
+		logs:    cfg.Logs,
+		stable:  cfg.Stable,
+		timeout: cfg.Timeout,
+		bolt:    bolt,
+	}, nil
+}
+
+// Opens the default Raft stores in cfg.Dir for those left nil, returning
+// the BoltDB store if one was opened.
+func openRaftStores(r *Ranker, cfg *ClusterConfig) (*raftboltdb.BoltStore, error) {
+	if cfg.Logs != nil && cfg.Stable != nil && cfg.Snapshots != nil {
+		return nil, nil
+	}
+	if cfg.Dir == "" {
+		cfg.Dir = r.StorageDir + raftDirSuffix
+	}
+	if err := os.MkdirAll(cfg.Dir, 0755); err != nil {
+		return nil, err
+	}
+	if cfg.Snapshots == nil {
+		snapshots, err := raft.NewFileSnapshotStore(cfg.Dir, raftSnapshotsRetained, cfg.Raft.LogOutput)
+		if err != nil {
+			return nil, err
+		}
+		cfg.Snapshots = snapshots
+	}
+	if cfg.Logs != nil && cfg.Stable != nil {
+		return nil, nil
+	}
+	bolt, err := raftboltdb.NewBoltStore(filepath.Join(cfg.Dir, "raft.db"))
+	if err != nil {
+		return nil, err
+	}
+	if cfg.Logs == nil {
+		cfg.Logs = bolt
+	}
+	if cfg.Stable == nil {
+		cfg.Stable = bolt
+	}
+	return bolt, nil
+}
+
+// Prepares the Ranker for Raft to rebuild it. Raft restores its latest
+// snapshot, which replaces the whole board, and replays the log after it;
+// without a snapshot the whole log is replayed, which needs an empty board,
+// since increments don't replay idempotently. A node without Raft state
+// must already be empty.
+func resetForRaft(r *Ranker, cfg ClusterConfig) error {
+	existing, err := raft.HasExistingState(cfg.Logs, cfg.Stable, cfg.Snapshots)
+	if err != nil {
+		return err
+	}
+	if !existing {
+		if r.Count() > 0 {
+			return ErrNotEmpty
+		}
+		return nil
+	}
+	snapshots, err := cfg.Snapshots.List()
+	if err != nil {
+		return err
+	}
+	if len(snapshots) > 0 {
+		return nil
+	}
+	return r.replaceAll(NewZSet())
+}
+
+// Bootstraps a new cluster from its initial members, on one node only.
+func (c *Cluster) Bootstrap(servers ...raft.Server) error {
+	return c.raft.BootstrapCluster(raft.Configuration{Servers: servers}).Error()
+}
+
+// Adds a voting member, on the leader.
+func (c *Cluster) Join(id, addr string) error {
+	return leaderError(c.raft.AddVoter(raft.ServerID(id), raft.ServerAddress(addr), 0, c.timeout).Error())
+}
+
+// Removes a member, on the leader.
+func (c *Cluster) Leave(id string) error {
+	return leaderError(c.raft.RemoveServer(raft.ServerID(id), 0, c.timeout).Error())
+}
+
+// Returns the id and address of the current leader, empty when unknown.
+func (c *Cluster) Leader() (string, string) {
+	addr, id := c.raft.LeaderWithID()
+	return string(id), string(addr)
+}
+
+// Reports whether this node is the leader.
+func (c *Cluster) IsLeader() bool {
+	return c.raft.State() == raft.Leader
+}
+
+// Returns the underlying Raft node.
+func (c *Cluster) Raft() *raft.Raft {
+	return c.raft
+}
+
+// Stops the Raft node and closes the default Raft stores. The Ranker stays
+// open and must be closed separately.
+func (c *Cluster) Close() error {
+	err := c.raft.Shutdown().Error()
+	if c.bolt != nil {
+		err = errors.Join(err, c.bolt.Close())
+	}
+	return err
+}
+
+// Updates or adds a player's score through the cluster.
+func (c *Cluster) Update(playerID string, score float64) error {
+	_, err := c.apply(ChangeSet, playerID, score)
+	return err
+}
+
+// Adds increment to a player's score through the cluster.
+func (c *Cluster) IncrBy(playerID string, increment float64) (float64, error) {
+	return c.apply(ChangeIncr, playerID, increment)
+}
+
+// Removes a player through the cluster.
+func (c *Cluster) Remove(playerID string) error {
+	_, err := c.apply(ChangeRemove, playerID, 0)
+	return err
+}
+
+// Retrieves a player's rank, linearizable.
+func (c *Cluster) Rank(playerID string) (*Entry, error) {
+	if err := c.linearize(); err != nil {
+		return nil, err
+	}
+	return c.r.Rank(playerID)
+}
+
+// Retrieves a player's score, linearizable.
+func (c *Cluster) Score(playerID string) (float64, error) {
+	if err := c.linearize(); err != nil {
+		return 0, err
+	}
+	return c.r.Score(playerID)
+}
+
+// Retrieves a range of ranking entries, linearizable.
+func (c *Cluster) Range(start, end int) ([]*Entry, error) {
+	if err := c.linearize(); err != nil {
+		return nil, err
+	}
+	return c.r.Range(start, end)
+}
+
+// Returns the number of players, linearizable.
+func (c *Cluster) Count() (int, error) {
+	if err := c.linearize(); err != nil {
+		return 0, err
+	}
+	return c.r.Count(), nil
+}
+
+// Commits a change and returns the score it produced.
+func (c *Cluster) apply(op ChangeOp, playerID string, value float64) (float64, error) {
+	future := c.raft.Apply(encodeCommand(op, playerID, value), c.timeout)
+	if err := future.Error(); err != nil {
+		return 0, leaderError(err)
+	}
+	resp := future.Response().(commandResult)
+	return resp.score, resp.err
+}
+
+// Waits until local reads reflect every write acknowledged before the call,
+// following the read index approach: note the commit index, confirm the
+// node still leads, then wait for the index to be applied. A new leader's
+// commit index may lag the old leader's, so once per term a barrier is
+// committed first. The term is read again after confirming leadership, so
+// leadership lost and regained in between is caught.
+func (c *Cluster) linearize() error {
+	deadline := time.Now().Add(c.timeout)
+	for time.Now().Before(deadline) {
+		term, err := c.stable.GetUint64(raftTermKey)
+		if err != nil {
+			return err
+		}
+		if c.barrierTerm.Load() != term {
+			if err := c.raft.Barrier(time.Until(deadline)).Error(); err != nil {
+				return leaderError(err)
+			}
+			if now, err := c.stable.GetUint64(raftTermKey); err != nil || now != term {
+				continue
+			}
+			c.barrierTerm.Store(term)
+		}
+		index := c.raft.CommitIndex()
+		if err := c.raft.VerifyLeader().Error(); err != nil {
+			return leaderError(err)
+		}
+		if now, err := c.stable.GetUint64(raftTermKey); err != nil || now != term {
+			continue
+		}
+		return c.waitApplied(index, deadline)
+	}
+	return raft.ErrEnqueueTimeout
+}
+
+// Waits until the FSM applied every command up to index. Raft only hands
+// commands to the FSM, so the entries after the last applied command are
+// checked for more; entries already compacted away were applied as part of
+// a snapshot.
+func (c *Cluster) waitApplied(index uint64, deadline time.Time) error {
+	timer := time.NewTimer(time.Until(deadline))
+	defer timer.Stop()
+	for {
+		applied, notify := c.fsm.progress()
+		pending, err := c.commandsBetween(applied, index)
+		if err != nil || !pending {
+			return err
+		}
+		select {
+		case <-notify:
+		case <-timer.C:
+			return raft.ErrEnqueueTimeout
+		}
+	}
+}
+
+// Reports whether the log holds a command after index from, up to index to.
+func (c *Cluster) commandsBetween(from, to uint64) (bool, error) {
+	for i := to; i > from; i-- {
+		var entry raft.Log
+		err := c.logs.GetLog(i, &entry)
+		if err == raft.ErrLogNotFound {
+			return false, nil
+		}
+		if err != nil {
+			return false, err
+		}
+		if entry.Type == raft.LogCommand {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// Maps Raft leadership errors to ErrNotLeader.
+func leaderError(err error) error {
+	if err == raft.ErrNotLeader || err == raft.ErrLeadershipLost {
+		return ErrNotLeader
+	}
+	return err
+}
+
+// Encodes a command as the op byte, the value and the key.
+func encodeCommand(op ChangeOp, playerID string, value float64) []byte {
+	buf := make([]byte, 9, 9+len(playerID))
+	buf[0] = byte(op)
+	binary.LittleEndian.PutUint64(buf[1:], math.Float64bits(value))
+	return append(buf, playerID...)
+}
+
+func decodeCommand(data []byte) (ChangeOp, string, float64, error) {
+	if len(data) < 9 {
+		return 0, "", 0, errReplProtocol
+	}
+	value := math.Float64frombits(binary.LittleEndian.Uint64(data[1:]))
+	return ChangeOp(data[0]), string(data[9:]), value, nil
+}
+
+// commandResult is what applying a command returned.
+type commandResult struct {
+	score float64
+	err   error
+}
+
+// clusterFSM applies committed commands to the Ranker and tracks the index
+// of the last one, notifying linearizable reads waiting for it.
+type clusterFSM struct {
+	r *Ranker
+
+	mu      sync.Mutex
+	applied uint64        // Index of the last applied command
+	notify  chan struct{} // Closed and replaced when applied moves
+}
+
+// Returns the applied index and a channel closed once it moves.
+func (f *clusterFSM) progress() (uint64, <-chan struct{}) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.applied, f.notify
+}
+
+// Records index as applied and wakes the waiting reads.
+func (f *clusterFSM) advance(index uint64) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.applied = index
+	close(f.notify)
+	f.notify = make(chan struct{})
+}
+
+func (f *clusterFSM) Apply(log *raft.Log) any {
+	defer f.advance(log.Index)
+	r := f.r
+	op, playerID, value, err := decodeCommand(log.Data)
+	if err != nil {
+		return commandResult{err: err}
+	}
+	switch op {
+	case ChangeSet:
+		return commandResult{score: value, err: r.Update(playerID, value)}
+	case ChangeIncr:
+		score, err := r.IncrBy(playerID, value)
+		return commandResult{score: score, err: err}
+	case ChangeRemove:
+		return commandResult{err: r.Remove(playerID)}
+	}
+	return commandResult{err: errReplProtocol}
+}
+
+// Captures the applied index and the ZSet as an image, encoded up front
+// since Persist runs concurrently with later applies. Raft calls this from
+// the same goroutine as Apply, so the two match.
+func (f *clusterFSM) Snapshot() (raft.FSMSnapshot, error) {
+	applied, _ := f.progress()
+	buf := bytes.NewBuffer(binary.LittleEndian.AppendUint64(nil, applied))
+	f.r.mu.RLock()
+	err := writeImage(buf, f.r.zset)
+	f.r.mu.RUnlock()
+	if err != nil {
+		return nil, err
+	}
+	return &clusterSnapshot{image: buf.Bytes()}, nil
+}
+
+func (f *clusterFSM) Restore(rc io.ReadCloser) error {
+	defer rc.Close()
+	var header [8]byte
+	if _, err := io.ReadFull(rc, header[:]); err != nil {
+		return err
+	}
+	z, err := readImage(rc)
+	if err != nil {
+		return err
+	}
+	if err := f.r.replaceAll(z); err != nil {
+		return err
+	}
+	f.advance(binary.LittleEndian.Uint64(header[:]))
+	return nil
+}
+
+// clusterSnapshot is an encoded image waiting to be persisted.
+type clusterSnapshot struct {
+	image []byte
+}
+
+func (s *clusterSnapshot) Persist(sink raft.SnapshotSink) error {
+	if _, err := sink.Write(s.image); err != nil {
+		sink.Cancel()
+		return err
+	}
+	return sink.Close()
+}
+
+func (s *clusterSnapshot) Release() {}
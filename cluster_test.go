@@ -0,0 +1,283 @@
+package ranker
+
+import (
+	"fmt"
+	"io"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/raft"
+	"github.com/stretchr/testify/assert"
+)
+
+// testNode is a cluster member with its own Ranker and Raft state.
+type testNode struct {
+	id        string
+	ranker    *Ranker
+	cluster   *Cluster
+	transport *raft.InmemTransport
+	logs      *raft.InmemStore
+	snapshots *raft.InmemSnapshotStore
+}
+
+// Starts the node, reusing its Raft state across restarts.
+func (n *testNode) start(t *testing.T) {
+	n.ranker = New(WithStore(NewMemoryStore()))
+	assert.NoError(t, n.ranker.Start())
+	c, err := NewCluster(n.ranker, ClusterConfig{
+		Raft:      testRaftConfig(n.id),
+		Transport: n.transport,
+		Logs:      n.logs,
+		Stable:    n.logs,
+		Snapshots: n.snapshots,
+	})
+	assert.NoError(t, err)
+	n.cluster = c
+}
+
+// Raft settings with short timeouts for tests.
+func testRaftConfig(id string) *raft.Config {
+	cfg := raft.DefaultConfig()
+	cfg.LocalID = raft.ServerID(id)
+	cfg.HeartbeatTimeout = 50 * time.Millisecond
+	cfg.ElectionTimeout = 50 * time.Millisecond
+	cfg.LeaderLeaseTimeout = 50 * time.Millisecond
+	cfg.CommitTimeout = 5 * time.Millisecond
+	cfg.LogOutput = io.Discard
+	return cfg
+}
+
+func (n *testNode) stop() {
+	n.cluster.Close()
+	n.ranker.Close()
+}
+
+// Starts a bootstrapped cluster of n connected nodes.
+func startCluster(t *testing.T, n int) []*testNode {
+	nodes := make([]*testNode, n)
+	var servers []raft.Server
+	for i := range nodes {
+		id := fmt.Sprintf("node%d", i)
+		addr, transport := raft.NewInmemTransport(raft.ServerAddress(id))
+		nodes[i] = &testNode{
+			id:        id,
+			transport: transport,
+			logs:      raft.NewInmemStore(),
+			snapshots: raft.NewInmemSnapshotStore(),
+		}
+		servers = append(servers, raft.Server{ID: raft.ServerID(id), Address: addr})
+	}
+	for _, a := range nodes {
+		for _, b := range nodes {
+			if a != b {
+				a.transport.Connect(b.transport.LocalAddr(), b.transport)
+			}
+		}
+	}
+	for _, node := range nodes {
+		node.start(t)
+	}
+	assert.NoError(t, nodes[0].cluster.Bootstrap(servers...))
+	return nodes
+}
+
+// Waits for a leader among the running nodes.
+func waitLeader(t *testing.T, nodes []*testNode) *testNode {
+	var leader *testNode
+	assert.Eventually(t, func() bool {
+		for _, node := range nodes {
+			if node.cluster.IsLeader() {
+				leader = node
+				return true
+			}
+		}
+		return false
+	}, 5*time.Second, 10*time.Millisecond)
+	return leader
+}
+
+func TestCluster(t *testing.T) {
+	nodes := startCluster(t, 3)
+	leader := waitLeader(t, nodes)
+
+	assert.NoError(t, leader.cluster.Update("a", 1))
+	assert.NoError(t, leader.cluster.Update("b", 2))
+	score, err := leader.cluster.IncrBy("a", 5)
+	assert.NoError(t, err)
+	assert.Equal(t, float64(6), score)
+	assert.NoError(t, leader.cluster.Remove("b"))
+	assert.ErrorIs(t, leader.cluster.Remove("b"), ErrKeyNotExist)
+
+	entry, err := leader.cluster.Rank("a")
+	assert.NoError(t, err)
+	assert.Equal(t, &Entry{Rank: 0, Score: 6, Key: "a"}, entry)
+
+	for _, node := range nodes {
+		if node == leader {
+			continue
+		}
+		assert.ErrorIs(t, node.cluster.Update("c", 3), ErrNotLeader)
+		_, err := node.cluster.Count()
+		assert.ErrorIs(t, err, ErrNotLeader)
+		// Followers apply the same log.
+		assert.Eventually(t, func() bool {
+			score, err := node.ranker.Score("a")
+			return err == nil && score == 6 && node.ranker.Count() == 1
+		}, 5*time.Second, 10*time.Millisecond)
+	}
+
+	// A new leader takes over with every acknowledged write.
+	leader.stop()
+	var rest []*testNode
+	for _, node := range nodes {
+		if node != leader {
+			rest = append(rest, node)
+		}
+	}
+	leader = waitLeader(t, rest)
+	count, err := leader.cluster.Count()
+	assert.NoError(t, err)
+	assert.Equal(t, 1, count)
+	assert.NoError(t, leader.cluster.Update("c", 3))
+	entries, err := leader.cluster.Range(0, -1)
+	assert.NoError(t, err)
+	assert.Equal(t, []*Entry{{Rank: 0, Score: 6, Key: "a"}, {Rank: 1, Score: 3, Key: "c"}}, entries)
+
+	for _, node := range rest {
+		node.stop()
+	}
+}
+
+func TestCluster_SnapshotRestore(t *testing.T) {
+	nodes := startCluster(t, 3)
+	leader := waitLeader(t, nodes)
+	for i := 0; i < 100; i++ {
+		_, err := leader.cluster.IncrBy(fmt.Sprintf("p%d", i%10), 1)
+		assert.NoError(t, err)
+	}
+
+	var follower *testNode
+	for _, node := range nodes {
+		if node != leader {
+			follower = node
+			break
+		}
+	}
+	assert.Eventually(t, func() bool {
+		return follower.cluster.Raft().AppliedIndex() >= leader.cluster.Raft().AppliedIndex()
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.NoError(t, follower.cluster.Raft().Snapshot().Error())
+	_, err := leader.cluster.IncrBy("p0", 1)
+	assert.NoError(t, err)
+
+	// The restarted node restores the snapshot and replays the rest of the
+	// log exactly once.
+	follower.stop()
+	follower.start(t)
+	assert.Eventually(t, func() bool {
+		score, err := follower.ranker.Score("p0")
+		return err == nil && score == 11 && follower.ranker.Count() == 10
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.NoError(t, follower.ranker.Verify())
+
+	for _, node := range nodes {
+		node.stop()
+	}
+}
+
+func TestCluster_DurableRestart(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "board")
+	start := func() (*Ranker, *Cluster) {
+		r := New(WithStorageDir(dir))
+		assert.NoError(t, r.Start())
+		_, transport := raft.NewInmemTransport("node0")
+		c, err := NewCluster(r, ClusterConfig{Raft: testRaftConfig("node0"), Transport: transport})
+		assert.NoError(t, err)
+		return r, c
+	}
+
+	r, c := start()
+	assert.NoError(t, c.Bootstrap(raft.Server{ID: "node0", Address: "node0"}))
+	assert.Eventually(t, c.IsLeader, 5*time.Second, 10*time.Millisecond)
+	_, err := c.IncrBy("a", 1)
+	assert.NoError(t, err)
+	_, err = c.IncrBy("a", 2)
+	assert.NoError(t, err)
+	assert.NoError(t, c.Update("b", 5))
+	assert.NoError(t, c.Close())
+	r.Close()
+
+	// The whole log replays onto an empty board, so increments apply once.
+	r, c = start()
+	assert.Eventually(t, c.IsLeader, 5*time.Second, 10*time.Millisecond)
+	score, err := c.Score("a")
+	assert.NoError(t, err)
+	assert.Equal(t, float64(3), score)
+	count, err := c.Count()
+	assert.NoError(t, err)
+	assert.Equal(t, 2, count)
+
+	assert.NoError(t, c.Raft().Snapshot().Error())
+	_, err = c.IncrBy("a", 1)
+	assert.NoError(t, err)
+	assert.NoError(t, c.Close())
+	r.Close()
+
+	// The snapshot replaces the board and the log after it replays.
+	r, c = start()
+	assert.Eventually(t, c.IsLeader, 5*time.Second, 10*time.Millisecond)
+	score, err = c.Score("a")
+	assert.NoError(t, err)
+	assert.Equal(t, float64(4), score)
+	assert.NoError(t, c.Close())
+	r.Close()
+}
+
+func TestCluster_NotEmpty(t *testing.T) {
+	r := New(WithStore(NewMemoryStore()))
+	assert.NoError(t, r.Start())
+	defer r.Close()
+	assert.NoError(t, r.Update("a", 1))
+
+	_, transport := raft.NewInmemTransport("node0")
+	_, err := NewCluster(r, ClusterConfig{Raft: testRaftConfig("node0"), Transport: transport, Dir: t.TempDir()})
+	assert.ErrorIs(t, err, ErrNotEmpty)
+	score, err := r.Score("a")
+	assert.NoError(t, err)
+	assert.Equal(t, float64(1), score)
+}
+
+func TestCluster_Approximate(t *testing.T) {
+	r := New(WithStorageDir(filepath.Join(t.TempDir(), "rank")), WithApproximateRanks(10, 8))
+	assert.NoError(t, r.Start())
+	defer r.Close()
+	_, transport := raft.NewInmemTransport("node0")
+	_, err := NewCluster(r, ClusterConfig{Raft: testRaftConfig("node0"), Transport: transport, Dir: t.TempDir()})
+	assert.ErrorIs(t, err, ErrNotSupported)
+}
+
+func TestCluster_ReadAfterMembershipChange(t *testing.T) {
+	nodes := startCluster(t, 2)
+	leader := waitLeader(t, nodes)
+	assert.NoError(t, leader.cluster.Update("a", 1))
+	// The last committed entry is a configuration change, which the FSM
+	// never sees.
+	var other *testNode
+	for _, node := range nodes {
+		if node != leader {
+			other = node
+		}
+	}
+	assert.NoError(t, leader.cluster.Leave(other.id))
+	count, err := leader.cluster.Count()
+	assert.NoError(t, err)
+	assert.Equal(t, 1, count)
+	term, err := leader.cluster.stable.GetUint64(raftTermKey)
+	assert.NoError(t, err)
+	assert.Equal(t, term, leader.cluster.barrierTerm.Load())
+
+	for _, node := range nodes {
+		node.stop()
+	}
+}
@@ -0,0 +1,368 @@
+// Command ranker inspects and edits a ranker store on disk.
+//
+//	ranker [-dir .rank] [-json] <command> [args]
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"text/tabwriter"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/werbenhu/ranker"
+)
+
+// command is a single ranker subcommand.
+type command struct {
+	usage string
+	run   func(c *cli, args []string) error
+}
+
+var commands = map[string]command{
+	"top":    {"top [n]", runTop},
+	"rank":   {"rank <id>", runRank},
+	"set":    {"set <id> <score>", runSet},
+	"incr":   {"incr <id> <delta>", runIncr},
+	"rm":     {"rm <id>", runRm},
+	"trim":   {"trim <n>", runTrim},
+	"count":  {"count", runCount},
+	"stats":  {"stats", runStats},
+	"export": {"export [-format json] [file]", runExport},
+	"import": {"import [-format json] [-mode merge-max] [file]", runImport},
+	"verify": {"verify [-repair]", runVerify},
+	"serve":  {"serve [-addr :9090]", runServe},
+}
+
+var order = []string{"top", "rank", "set", "incr", "rm", "trim", "count", "stats", "export", "import", "verify", "serve"}
+
+var errUsage = errors.New("usage")
+
+// cli holds the state shared by all subcommands.
+type cli struct {
+	rk   *ranker.Ranker
+	reg  *prometheus.Registry // Holds the metrics of rk
+	json bool
+	out  io.Writer
+}
+
+func main() {
+	dir := flag.String("dir", ".rank", "storage directory of the ranker")
+	asJSON := flag.Bool("json", false, "print results as JSON")
+	flag.Usage = usage
+	flag.Parse()
+
+	if flag.NArg() == 0 {
+		usage()
+		os.Exit(2)
+	}
+	name := flag.Arg(0)
+	cmd, ok := commands[name]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "unknown command %q\n", name)
+		usage()
+		os.Exit(2)
+	}
+
+	reg := prometheus.NewRegistry()
+	rk := ranker.New(ranker.WithStorageDir(*dir), ranker.WithMetrics(reg))
+	if err := rk.Start(); err != nil {
+		fmt.Fprintf(os.Stderr, "failed to open %s: %v\n", *dir, err)
+		os.Exit(1)
+	}
+
+	c := &cli{rk: rk, reg: reg, json: *asJSON, out: os.Stdout}
+	err := cmd.run(c, flag.Args()[1:])
+	rk.Close()
+
+	if errors.Is(err, errUsage) {
+		fmt.Fprintf(os.Stderr, "usage: ranker %s\n", cmd.usage)
+		os.Exit(2)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", name, err)
+		os.Exit(1)
+	}
+}
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "usage: ranker [flags] <command> [args]\n\ncommands:\n")
+	for _, name := range order {
+		fmt.Fprintf(os.Stderr, "  %s\n", commands[name].usage)
+	}
+	fmt.Fprintf(os.Stderr, "\nflags:\n")
+	flag.PrintDefaults()
+}
+
+// Prints entries as a table or a JSON array.
+func (c *cli) printEntries(entries []*ranker.Entry) error {
+	if c.json {
+		return c.printJSON(entries)
+	}
+	w := tabwriter.NewWriter(c.out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "RANK\tKEY\tSCORE")
+	for _, e := range entries {
+		fmt.Fprintf(w, "%d\t%s\t%v\n", e.Rank, e.Key, e.Score)
+	}
+	return w.Flush()
+}
+
+// Prints a single value as JSON.
+func (c *cli) printJSON(v any) error {
+	enc := json.NewEncoder(c.out)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+func parseScore(s string) (float64, error) {
+	score, err := strconv.ParseFloat(s, 64)
+	if err != nil || math.IsNaN(score) {
+		return 0, fmt.Errorf("invalid score %q", s)
+	}
+	return score, nil
+}
+
+func runTop(c *cli, args []string) error {
+	n := 10
+	if len(args) > 1 {
+		return errUsage
+	}
+	if len(args) == 1 {
+		v, err := strconv.Atoi(args[0])
+		if err != nil || v <= 0 {
+			return errUsage
+		}
+		n = v
+	}
+	entries, err := c.rk.Range(0, n-1)
+	if err != nil {
+		return err
+	}
+	return c.printEntries(entries)
+}
+
+func runRank(c *cli, args []string) error {
+	if len(args) != 1 {
+		return errUsage
+	}
+	entry, err := c.rk.Rank(args[0])
+	if err != nil {
+		return err
+	}
+	return c.printEntries([]*ranker.Entry{entry})
+}
+
+func runSet(c *cli, args []string) error {
+	if len(args) != 2 {
+		return errUsage
+	}
+	score, err := parseScore(args[1])
+	if err != nil {
+		return err
+	}
+	if err := c.rk.Update(args[0], score); err != nil {
+		return err
+	}
+	return runRank(c, args[:1])
+}
+
+func runIncr(c *cli, args []string) error {
+	if len(args) != 2 {
+		return errUsage
+	}
+	delta, err := parseScore(args[1])
+	if err != nil {
+		return err
+	}
+	if _, err := c.rk.IncrBy(args[0], delta); err != nil {
+		return err
+	}
+	return runRank(c, args[:1])
+}
+
+func runRm(c *cli, args []string) error {
+	if len(args) != 1 {
+		return errUsage
+	}
+	return c.rk.Remove(args[0])
+}
+
+func runTrim(c *cli, args []string) error {
+	if len(args) != 1 {
+		return errUsage
+	}
+	n, err := strconv.Atoi(args[0])
+	if err != nil || n < 0 {
+		return errUsage
+	}
+	removed, err := c.rk.Trim(n)
+	if err != nil {
+		return err
+	}
+	if c.json {
+		return c.printJSON(map[string]int{"removed": removed})
+	}
+	_, err = fmt.Fprintf(c.out, "removed %d\n", removed)
+	return err
+}
+
+func runCount(c *cli, args []string) error {
+	if len(args) != 0 {
+		return errUsage
+	}
+	if c.json {
+		return c.printJSON(map[string]int{"count": c.rk.Count()})
+	}
+	_, err := fmt.Fprintln(c.out, c.rk.Count())
+	return err
+}
+
+func runStats(c *cli, args []string) error {
+	if len(args) != 0 {
+		return errUsage
+	}
+	stats := c.rk.Stats()
+	if c.json {
+		return c.printJSON(stats)
+	}
+	w := tabwriter.NewWriter(c.out, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "storage dir\t%s\n", stats.StorageDir)
+	fmt.Fprintf(w, "count\t%d\n", stats.Count)
+	fmt.Fprintf(w, "skiplist level\t%d\n", stats.Level)
+	fmt.Fprintf(w, "disk usage\t%d\n", stats.DiskUsage)
+	return w.Flush()
+}
+
+func runExport(c *cli, args []string) error {
+	fs := flag.NewFlagSet("export", flag.ContinueOnError)
+	formatName := fs.String("format", "json", "output format: csv, json or ndjson")
+	if err := fs.Parse(args); err != nil || fs.NArg() > 1 {
+		return errUsage
+	}
+	format, err := ranker.ParseFormat(*formatName)
+	if err != nil {
+		return err
+	}
+
+	if fs.NArg() == 0 {
+		return c.rk.Export(c.out, format)
+	}
+	f, err := os.Create(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	if err := c.rk.Export(f, format); err != nil {
+		f.Close()
+		return err
+	}
+	// A failed close can lose buffered data, so it fails the export too.
+	return f.Close()
+}
+
+func runImport(c *cli, args []string) error {
+	fs := flag.NewFlagSet("import", flag.ContinueOnError)
+	formatName := fs.String("format", "json", "input format: csv, json or ndjson")
+	modeName := fs.String("mode", "merge-max", "how to combine scores: replace, merge-max or merge-sum")
+	if err := fs.Parse(args); err != nil || fs.NArg() > 1 {
+		return errUsage
+	}
+	format, err := ranker.ParseFormat(*formatName)
+	if err != nil {
+		return err
+	}
+	mode, err := ranker.ParseImportMode(*modeName)
+	if err != nil {
+		return err
+	}
+
+	var in io.Reader = os.Stdin
+	if fs.NArg() == 1 {
+		f, err := os.Open(fs.Arg(0))
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		in = f
+	}
+	n, err := c.rk.Import(in, format, mode)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(os.Stderr, "imported %d entries\n", n)
+	return err
+}
+
+func runVerify(c *cli, args []string) error {
+	fs := flag.NewFlagSet("verify", flag.ContinueOnError)
+	repair := fs.Bool("repair", false, "rebuild the in-memory leaderboard from the store on mismatch")
+	if err := fs.Parse(args); err != nil || fs.NArg() != 0 {
+		return errUsage
+	}
+	report, err := c.rk.Check(*repair)
+	if err != nil {
+		return err
+	}
+
+	if c.json {
+		if err := c.printJSON(report); err != nil {
+			return err
+		}
+	} else {
+		fmt.Fprintf(c.out, "stored %d, ranked %d\n", report.Stored, report.Ranked)
+		if report.Structure != "" {
+			fmt.Fprintf(c.out, "skiplist: %s\n", report.Structure)
+		}
+		for _, d := range report.Discrepancies {
+			fmt.Fprintln(c.out, d)
+		}
+		switch {
+		case report.OK():
+			fmt.Fprintln(c.out, "ok")
+		case report.Repaired:
+			fmt.Fprintln(c.out, "repaired")
+		}
+	}
+
+	if !report.OK() && !report.Repaired {
+		return ranker.ErrInconsistent
+	}
+	return nil
+}
+
+// Serves the leaderboard metrics for Prometheus at /metrics until interrupted.
+func runServe(c *cli, args []string) error {
+	fs := flag.NewFlagSet("serve", flag.ContinueOnError)
+	addr := fs.String("addr", ":9090", "address to serve metrics on")
+	if err := fs.Parse(args); err != nil || fs.NArg() != 0 {
+		return errUsage
+	}
+	c.reg.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.HandlerFor(c.reg, promhttp.HandlerOpts{}))
+	srv := &http.Server{Addr: *addr, Handler: mux}
+
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt)
+	go func() {
+		<-interrupt
+		srv.Close()
+	}()
+	fmt.Fprintf(os.Stderr, "serving metrics on %s/metrics\n", *addr)
+	if err := srv.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
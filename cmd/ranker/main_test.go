@@ -0,0 +1,120 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/werbenhu/ranker"
+)
+
+func newTestCLI(t *testing.T) (*cli, *bytes.Buffer) {
+	rk := ranker.New(ranker.WithStore(ranker.NewMemoryStore()))
+	assert.NoError(t, rk.Start())
+	t.Cleanup(rk.Close)
+	out := &bytes.Buffer{}
+	return &cli{rk: rk, out: out}, out
+}
+
+// Runs the named command and returns what it printed.
+func run(c *cli, out *bytes.Buffer, name string, args ...string) (string, error) {
+	out.Reset()
+	err := commands[name].run(c, args)
+	return out.String(), err
+}
+
+func TestCommands(t *testing.T) {
+	c, out := newTestCLI(t)
+
+	got, err := run(c, out, "set", "alice", "100")
+	assert.NoError(t, err)
+	assert.Contains(t, got, "alice")
+	_, err = run(c, out, "set", "bob", "50")
+	assert.NoError(t, err)
+	_, err = run(c, out, "incr", "bob", "60")
+	assert.NoError(t, err)
+	_, err = run(c, out, "incr", "carol", "10")
+	assert.NoError(t, err)
+
+	got, err = run(c, out, "count")
+	assert.NoError(t, err)
+	assert.Equal(t, "3\n", got)
+
+	c.json = true
+	got, err = run(c, out, "top", "2")
+	assert.NoError(t, err)
+	var entries []*ranker.Entry
+	assert.NoError(t, json.Unmarshal([]byte(got), &entries))
+	assert.Equal(t, []*ranker.Entry{{Rank: 0, Score: 110, Key: "bob"}, {Rank: 1, Score: 100, Key: "alice"}}, entries)
+
+	got, err = run(c, out, "rank", "carol")
+	assert.NoError(t, err)
+	assert.NoError(t, json.Unmarshal([]byte(got), &entries))
+	assert.Equal(t, []*ranker.Entry{{Rank: 2, Score: 10, Key: "carol"}}, entries)
+	c.json = false
+
+	got, err = run(c, out, "verify")
+	assert.NoError(t, err)
+	assert.Contains(t, got, "ok")
+
+	_, err = run(c, out, "rm", "carol")
+	assert.NoError(t, err)
+	_, err = run(c, out, "rank", "carol")
+	assert.ErrorIs(t, err, ranker.ErrKeyNotExist)
+
+	got, err = run(c, out, "trim", "1")
+	assert.NoError(t, err)
+	assert.Equal(t, "removed 1\n", got)
+	assert.Equal(t, 1, c.rk.Count())
+}
+
+func TestCommands_ExportImport(t *testing.T) {
+	c, out := newTestCLI(t)
+	for _, args := range [][]string{{"a", "1"}, {"b", "2"}, {"c", "3"}} {
+		_, err := run(c, out, "set", args...)
+		assert.NoError(t, err)
+	}
+	file := filepath.Join(t.TempDir(), "board.csv")
+	_, err := run(c, out, "export", "-format", "csv", file)
+	assert.NoError(t, err)
+
+	d, out := newTestCLI(t)
+	_, err = run(d, out, "import", "-format", "csv", "-mode", "replace", file)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, d.rk.Count())
+	entry, err := d.rk.Rank("c")
+	assert.NoError(t, err)
+	assert.Equal(t, float64(3), entry.Score)
+
+	_, err = run(d, out, "import", "-format", "xml", file)
+	assert.ErrorIs(t, err, ranker.ErrUnknownFormat)
+}
+
+func TestCommands_Usage(t *testing.T) {
+	c, out := newTestCLI(t)
+	for _, args := range [][]string{
+		{"top", "0"},
+		{"top", "1", "2"},
+		{"rank"},
+		{"set", "a"},
+		{"incr", "a", "1", "2"},
+		{"rm"},
+		{"trim"},
+		{"trim", "x"},
+		{"trim", "-1"},
+		{"count", "x"},
+		{"stats", "x"},
+		{"verify", "x"},
+	} {
+		_, err := run(c, out, args[0], args[1:]...)
+		assert.ErrorIs(t, err, errUsage, args)
+	}
+	_, err := run(c, out, "set", "a", "high")
+	assert.ErrorContains(t, err, "invalid score")
+	_, err = run(c, out, "set", "a", "NaN")
+	assert.ErrorContains(t, err, "invalid score")
+	_, err = run(c, out, "export", filepath.Join(t.TempDir(), "missing", "out.json"))
+	assert.Error(t, err)
+}
@@ -0,0 +1,254 @@
+package ranker
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRanker_CanceledContext(t *testing.T) {
+	r := New(WithStore(NewMemoryStore()))
+	assert.NoError(t, r.Start())
+	defer r.Close()
+	assert.NoError(t, r.Update("a", 1))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.ErrorIs(t, r.UpdateContext(ctx, "b", 2), context.Canceled)
+	_, err := r.IncrByContext(ctx, "a", 1)
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.ErrorIs(t, r.RemoveContext(ctx, "a"), context.Canceled)
+	_, err = r.RankContext(ctx, "a")
+	assert.ErrorIs(t, err, context.Canceled)
+	_, err = r.RangeContext(ctx, 0, -1)
+	assert.ErrorIs(t, err, context.Canceled)
+
+	// Nothing changed.
+	assert.Equal(t, 1, r.Count())
+	score, err := r.Score("a")
+	assert.NoError(t, err)
+	assert.Equal(t, float64(1), score)
+}
+
+func TestRanker_MaintenanceContext(t *testing.T) {
+	tracer := &testTracer{}
+	dir := t.TempDir()
+	r := New(WithStorageDir(filepath.Join(dir, "rank")), WithTracer(tracer))
+	assert.NoError(t, r.Start())
+	defer r.Close()
+	assert.NoError(t, r.Update("a", 1))
+
+	ctx := context.Background()
+	snapshot := filepath.Join(dir, "snapshot")
+	assert.NoError(t, r.SnapshotContext(ctx, snapshot))
+	assert.NoError(t, r.Update("b", 2))
+	assert.NoError(t, r.VerifyContext(ctx))
+	report, err := r.CheckContext(ctx, false)
+	assert.NoError(t, err)
+	assert.True(t, report.OK())
+	assert.Equal(t, 2, r.StatsContext(ctx).Count)
+
+	canceled, cancel := context.WithCancel(ctx)
+	cancel()
+	assert.ErrorIs(t, r.VerifyContext(canceled), context.Canceled)
+	_, err = r.CheckContext(canceled, true)
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.ErrorIs(t, r.SnapshotContext(canceled, filepath.Join(dir, "other")), context.Canceled)
+	assert.NoDirExists(t, filepath.Join(dir, "other"))
+	assert.ErrorIs(t, r.RestoreContext(canceled, snapshot), context.Canceled)
+	assert.Equal(t, 2, r.Count())
+
+	assert.NoError(t, r.RestoreContext(ctx, snapshot))
+	assert.Equal(t, 1, r.Count())
+
+	var names []string
+	for _, span := range tracer.spans {
+		names = append(names, span.name)
+	}
+	assert.Subset(t, names, []string{"ranker.snapshot", "ranker.verify", "ranker.check", "ranker.stats", "ranker.restore"})
+}
+
+func TestRanker_RangeContext(t *testing.T) {
+	r := New(WithStore(NewMemoryStore()))
+	assert.NoError(t, r.Start())
+	defer r.Close()
+	for i := 0; i < 10; i++ {
+		assert.NoError(t, r.Update(fmt.Sprintf("p%d", i), float64(i)))
+	}
+
+	entries, err := r.RangeContext(context.Background(), -3, -1)
+	assert.NoError(t, err)
+	assert.Equal(t, []*Entry{
+		{Rank: 7, Score: 2, Key: "p2"},
+		{Rank: 8, Score: 1, Key: "p1"},
+		{Rank: 9, Score: 0, Key: "p0"},
+	}, entries)
+	entries, err = r.RangeContext(context.Background(), 8, 20)
+	assert.NoError(t, err)
+	assert.Len(t, entries, 2)
+	entries, err = r.RangeContext(context.Background(), 5, 2)
+	assert.NoError(t, err)
+	assert.Empty(t, entries)
+}
+
+func TestRanker_StartContext(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "rank")
+	r := New(WithStorageDir(dir))
+	assert.NoError(t, r.Start())
+	_, err := r.Import(strings.NewReader(csvRows(5000)), FormatCSV, ImportReplace)
+	assert.NoError(t, err)
+	r.Close()
+	// Drop the image, so the next Start reads every record.
+	assert.NoError(t, os.Remove(filepath.Join(dir, imageFileName)))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	r = New(WithStorageDir(dir))
+	assert.ErrorIs(t, r.StartContext(ctx), context.Canceled)
+	// A failed Start ends like a failed background load.
+	<-r.Ready()
+	assert.ErrorIs(t, r.LoadError(), context.Canceled)
+	_, err = r.Rank("p1")
+	assert.ErrorIs(t, err, context.Canceled)
+	// The store the attempt opened was closed, a retry opens it again.
+	assert.ErrorIs(t, r.Update("p1", 1), ErrStoreClosed)
+	assert.NoError(t, r.StartContext(context.Background()))
+	<-r.Ready()
+	assert.NoError(t, r.LoadError())
+	assert.Equal(t, 5000, r.Count())
+	r.Close()
+	assert.NoError(t, os.Remove(filepath.Join(dir, imageFileName)))
+
+	r = New(WithStorageDir(dir), WithAsyncStart())
+	assert.NoError(t, r.StartContext(ctx))
+	<-r.Ready()
+	assert.ErrorIs(t, r.LoadError(), context.Canceled)
+	r.Close()
+
+	r = New(WithStorageDir(dir))
+	assert.NoError(t, r.StartContext(context.Background()))
+	defer r.Close()
+	assert.Equal(t, 5000, r.Count())
+}
+
+func TestRanker_StartCanceled(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "rank")
+	r := New(WithStorageDir(dir))
+	assert.NoError(t, r.Start())
+	for i := 0; i < 10; i++ {
+		assert.NoError(t, r.Update(fmt.Sprintf("p%d", i), float64(i)))
+	}
+	r.Close()
+
+	// Too small for the periodic checks, and loaded from the image.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	r = New(WithStorageDir(dir))
+	assert.ErrorIs(t, r.StartContext(ctx), context.Canceled)
+	r.Close()
+	r = New(WithStorageDir(dir), WithApproximateRanks(5, 6))
+	assert.ErrorIs(t, r.StartContext(ctx), context.Canceled)
+	r.Close()
+}
+
+func TestRanker_StartRetry(t *testing.T) {
+	store := NewMemoryStore()
+	for i := 0; i < 5000; i++ {
+		assert.NoError(t, store.Set([]byte(fmt.Sprintf("p%d", i)), float64ToBytes(float64(i))))
+	}
+
+	// A store passed with WithStore stays open for the retry.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	r := New(WithStore(store))
+	assert.ErrorIs(t, r.StartContext(ctx), context.Canceled)
+	<-r.Ready()
+	_, err := store.Get([]byte("p1"))
+	assert.NoError(t, err)
+	assert.NoError(t, r.Start())
+	defer r.Close()
+	assert.Equal(t, 5000, r.Count())
+}
+
+// cancelWriter cancels a context on its first write.
+type cancelWriter struct {
+	bytes.Buffer
+	cancel context.CancelFunc
+}
+
+func (w *cancelWriter) Write(p []byte) (int, error) {
+	w.cancel()
+	return w.Buffer.Write(p)
+}
+
+func TestRanker_ExportContext(t *testing.T) {
+	r := New(WithStore(NewMemoryStore()))
+	assert.NoError(t, r.Start())
+	defer r.Close()
+	_, err := r.Import(strings.NewReader(csvRows(5000)), FormatCSV, ImportReplace)
+	assert.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	w := &cancelWriter{cancel: cancel}
+	assert.ErrorIs(t, r.ExportContext(ctx, w, FormatNDJSON), context.Canceled)
+	assert.Less(t, strings.Count(w.String(), "\n"), 5000)
+}
+
+// cancelReader cancels a context once n bytes were read.
+type cancelReader struct {
+	r      io.Reader
+	n      int
+	cancel context.CancelFunc
+}
+
+func (r *cancelReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	if r.n -= n; r.n <= 0 {
+		r.cancel()
+	}
+	return n, err
+}
+
+func TestRanker_ImportContext(t *testing.T) {
+	r := New(WithStore(NewMemoryStore()))
+	assert.NoError(t, r.Start())
+	defer r.Close()
+
+	// Cancel once the first batch has been read.
+	rows := csvRows(3 * importBatchSize)
+	ctx, cancel := context.WithCancel(context.Background())
+	rd := &cancelReader{r: strings.NewReader(rows), n: len(rows) / 2, cancel: cancel}
+	_, err := r.ImportContext(ctx, rd, FormatCSV, ImportMergeMax)
+	assert.ErrorIs(t, err, context.Canceled)
+
+	// Only whole batches committed before cancellation were applied.
+	count := r.Count()
+	assert.Positive(t, count)
+	assert.Less(t, count, 3*importBatchSize)
+	assert.Zero(t, count%importBatchSize)
+	assert.NoError(t, r.Verify())
+
+	// A canceled replace applies nothing.
+	ctx, cancel = context.WithCancel(context.Background())
+	rd = &cancelReader{r: strings.NewReader(csvRows(10)), n: 10, cancel: cancel}
+	_, err = r.ImportContext(ctx, rd, FormatCSV, ImportReplace)
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Equal(t, count, r.Count())
+	assert.NoError(t, r.Verify())
+}
+
+// Returns CSV rows of n players.
+func csvRows(n int) string {
+	var b strings.Builder
+	for i := 0; i < n; i++ {
+		fmt.Fprintf(&b, "p%d,%d\n", i, i)
+	}
+	return b.String()
+}
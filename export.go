@@ -0,0 +1,543 @@
+package ranker
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math"
+	"strconv"
+	"strings"
+)
+
+const (
+	importBatchSize = 10000 // Rows written per store batch during Import
+)
+
+var (
+	ErrUnknownFormat = errors.New("unknown format")
+	ErrUnknownMode   = errors.New("unknown import mode")
+)
+
+// Format is a bulk serialization format for leaderboards.
+type Format int
+
+const (
+	FormatCSV    Format = iota // rank,key,score rows with a header line
+	FormatJSON                 // A single JSON array of entries
+	FormatNDJSON               // One JSON entry per line
+)
+
+// Parses a format name: csv, json or ndjson.
+func ParseFormat(name string) (Format, error) {
+	switch strings.ToLower(name) {
+	case "csv":
+		return FormatCSV, nil
+	case "json":
+		return FormatJSON, nil
+	case "ndjson", "jsonl":
+		return FormatNDJSON, nil
+	}
+	return 0, fmt.Errorf("%w: %q", ErrUnknownFormat, name)
+}
+
+// String returns the format name.
+func (f Format) String() string {
+	switch f {
+	case FormatCSV:
+		return "csv"
+	case FormatJSON:
+		return "json"
+	case FormatNDJSON:
+		return "ndjson"
+	}
+	return "unknown"
+}
+
+// ImportMode decides how imported scores combine with existing ones.
+type ImportMode int
+
+const (
+	ImportReplace  ImportMode = iota // Drop the current board and keep only imported rows
+	ImportMergeMax                   // Keep the higher of the existing and imported score
+	ImportMergeSum                   // Add the imported score to the existing one
+)
+
+// Parses an import mode name: replace, merge-max or merge-sum.
+func ParseImportMode(name string) (ImportMode, error) {
+	switch strings.ToLower(name) {
+	case "replace":
+		return ImportReplace, nil
+	case "merge-max":
+		return ImportMergeMax, nil
+	case "merge-sum":
+		return ImportMergeSum, nil
+	}
+	return 0, fmt.Errorf("%w: %q", ErrUnknownMode, name)
+}
+
+// String returns the import mode name.
+func (m ImportMode) String() string {
+	switch m {
+	case ImportReplace:
+		return "replace"
+	case ImportMergeMax:
+		return "merge-max"
+	case ImportMergeSum:
+		return "merge-sum"
+	}
+	return "unknown"
+}
+
+// Writes the whole leaderboard to w in rank order.
+func (r *Ranker) Export(w io.Writer, format Format) error {
+	return r.ExportContext(context.Background(), w, format)
+}
+
+// Like Export, stopping with the error of ctx once it is done. Whatever was
+// written to w by then is left as is.
+func (r *Ranker) ExportContext(ctx context.Context, w io.Writer, format Format) (err error) {
+	op := r.begin(ctx, opExport, slog.String("format", format.String()))
+	defer op.end(&err)
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if err := r.checkReady(); err != nil {
+		return err
+	}
+
+	bw := bufio.NewWriter(w)
+	var enc exporter
+	switch format {
+	case FormatCSV:
+		enc = &csvExporter{w: csv.NewWriter(bw)}
+	case FormatJSON:
+		enc = &jsonExporter{w: bw, array: true}
+	case FormatNDJSON:
+		enc = &jsonExporter{w: bw}
+	default:
+		return ErrUnknownFormat
+	}
+
+	if err := enc.begin(); err != nil {
+		return err
+	}
+	rank := 0
+	for x := r.zset.zset.zsl.tail; x != nil; x = x.backward {
+		if err := checkCanceled(ctx, rank+1); err != nil {
+			return err
+		}
+		if err := enc.write(&Entry{Rank: rank, Score: x.score, Key: x.member}); err != nil {
+			return err
+		}
+		rank++
+	}
+	if err := enc.end(); err != nil {
+		return err
+	}
+	return bw.Flush()
+}
+
+// exporter encodes entries in one of the export formats.
+type exporter interface {
+	begin() error
+	write(e *Entry) error
+	end() error
+}
+
+// csvExporter writes a header line followed by rank,key,score rows.
+type csvExporter struct {
+	w *csv.Writer
+}
+
+func (e *csvExporter) begin() error {
+	return e.w.Write([]string{"rank", "key", "score"})
+}
+
+func (e *csvExporter) write(entry *Entry) error {
+	return e.w.Write([]string{
+		strconv.Itoa(entry.Rank),
+		entry.Key,
+		strconv.FormatFloat(entry.Score, 'g', -1, 64),
+	})
+}
+
+func (e *csvExporter) end() error {
+	e.w.Flush()
+	return e.w.Error()
+}
+
+// jsonExporter writes either a JSON array or one object per line.
+type jsonExporter struct {
+	w     *bufio.Writer
+	array bool
+	count int
+}
+
+func (e *jsonExporter) begin() error {
+	if e.array {
+		_, err := e.w.WriteString("[")
+		return err
+	}
+	return nil
+}
+
+func (e *jsonExporter) write(entry *Entry) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	if e.array {
+		if e.count > 0 {
+			e.w.WriteByte(',')
+		}
+		e.w.WriteByte('\n')
+	}
+	e.count++
+	if _, err := e.w.Write(data); err != nil {
+		return err
+	}
+	if !e.array {
+		return e.w.WriteByte('\n')
+	}
+	return nil
+}
+
+func (e *jsonExporter) end() error {
+	if e.array {
+		_, err := e.w.WriteString("\n]\n")
+		return err
+	}
+	return nil
+}
+
+// Reads entries from rd and applies them according to mode.
+// Merged rows are written to the store in batches and added to the in-memory
+// set after each batch commits, so memory held by the import itself stays
+// bounded by the batch size. ImportReplace reads the whole input first and
+// only then swaps it in, so a malformed row or a read error leaves the board
+// untouched. Returns the number of rows read.
+func (r *Ranker) Import(rd io.Reader, format Format, mode ImportMode) (int, error) {
+	return r.ImportContext(context.Background(), rd, format, mode)
+}
+
+// Like Import, stopping with the error of ctx once it is done. When merging,
+// batches committed by then stay applied and the pending one is dropped, so
+// the returned count covers more rows than were kept. A canceled
+// ImportReplace applies nothing.
+func (r *Ranker) ImportContext(ctx context.Context, rd io.Reader, format Format, mode ImportMode) (_ int, err error) {
+	op := r.begin(ctx, opImport, slog.String("format", format.String()), slog.String("mode", mode.String()))
+	defer op.end(&err)
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	var next func() (string, float64, error)
+	switch format {
+	case FormatCSV:
+		next = csvReader(rd)
+	case FormatJSON:
+		next = jsonReader(rd)
+	case FormatNDJSON:
+		next = ndjsonReader(rd)
+	default:
+		return 0, ErrUnknownFormat
+	}
+	switch mode {
+	case ImportReplace, ImportMergeMax, ImportMergeSum:
+	default:
+		return 0, ErrUnknownMode
+	}
+
+	if mode == ImportReplace {
+		return r.importReplace(ctx, next)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err := r.checkReady(); err != nil {
+		return 0, err
+	}
+	// Imported rows are not logged one by one, followers resync instead.
+	defer r.resetChanges()
+
+	count := 0
+	pending := make(map[string]float64, importBatchSize)
+	batch := r.store.NewBatch()
+	defer func() { batch.Close() }()
+
+	flush := func() error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := batch.Commit(); err != nil {
+			return err
+		}
+		for key, score := range pending {
+			if err := r.zadd(key, score); err != nil {
+				return err
+			}
+		}
+		clear(pending)
+		batch.Close()
+		batch = r.store.NewBatch()
+		return nil
+	}
+
+	for {
+		key, score, err := next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return count, fmt.Errorf("row %d: %w", count+1, err)
+		}
+
+		existing, ok := pending[key]
+		if !ok {
+			existing, err = r.score(key)
+			ok = err == nil
+		}
+		if ok {
+			if mode == ImportMergeSum {
+				score += existing
+			} else if existing > score {
+				score = existing
+			}
+		}
+
+		if r.approx != nil {
+			// Placing a player needs its previous score, so write one by one.
+			if err := checkCanceled(ctx, count+1); err != nil {
+				return count, err
+			}
+			if err := r.set(key, score); err != nil {
+				return count, err
+			}
+			count++
+			continue
+		}
+
+		pending[key] = score
+		if err := batch.Set(unsafeStringToBytes(key), float64ToBytes(score)); err != nil {
+			return count, err
+		}
+		count++
+
+		if len(pending) >= importBatchSize {
+			if err := flush(); err != nil {
+				return count, err
+			}
+		}
+	}
+	if err := flush(); err != nil {
+		return count, err
+	}
+	return count, r.enforceMaxSize()
+}
+
+// Reads every row without holding the lock, then replaces the board with
+// them. With a Pebble store the rows are staged next to it in bounded
+// batches, see switchStaged, and an approximate board never holds more than
+// its head in memory; otherwise they are collected into a set for swap.
+func (r *Ranker) importReplace(ctx context.Context, next func() (string, float64, error)) (int, error) {
+	r.mu.RLock()
+	ps, _ := r.store.(*PebbleStore)
+	r.mu.RUnlock()
+	var s *stagedStore
+	if ps != nil {
+		var err error
+		if s, err = r.stage(ps.Dir()); err != nil {
+			return 0, err
+		}
+		defer s.discard()
+	}
+	var staged *ZSet
+	if s == nil || r.approx == nil {
+		staged = NewZSet()
+	}
+
+	count := 0
+	for {
+		key, score, err := next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return count, fmt.Errorf("row %d: %w", count+1, err)
+		}
+		if err := checkCanceled(ctx, count+1); err != nil {
+			return count, err
+		}
+		if staged != nil {
+			staged.ZAdd(score, key)
+		}
+		if s != nil {
+			if err := s.put(key, score); err != nil {
+				return count, err
+			}
+		}
+		count++
+	}
+	if err := ctx.Err(); err != nil {
+		return count, err
+	}
+	if s != nil {
+		return count, r.switchStaged(ctx, s, staged)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err := r.checkReady(); err != nil {
+		return count, err
+	}
+	// Followers resync instead of replaying the rows.
+	defer r.resetChanges()
+	return count, r.swap(staged)
+}
+
+// Replaces the whole board with z, the caller holds the write lock. The
+// store is rewritten in a single batch that also deletes the players
+// missing from z, so a failed commit leaves both the store and the
+// in-memory set as they were; Pebble stores are staged instead, see
+// replaceWith. The WithMaxSize cap applies afterwards.
+func (r *Ranker) swap(z *ZSet) error {
+	batch := r.store.NewBatch()
+	defer batch.Close()
+	err := r.store.Iterate(nil, nil, func(key, _ []byte) error {
+		if _, ok := z.zset.dict[unsafeBytesToString(key)]; ok {
+			return nil
+		}
+		return batch.Delete(key)
+	})
+	if err != nil {
+		return err
+	}
+	for x := z.zset.zsl.head.level[0].forward; x != nil; x = x.level[0].forward {
+		if err := batch.Set(unsafeStringToBytes(x.member), float64ToBytes(x.score)); err != nil {
+			return err
+		}
+	}
+	if err := batch.Commit(); err != nil {
+		return err
+	}
+
+	if r.approx != nil {
+		r.approxFill(z)
+	} else {
+		r.zset = z
+	}
+	return r.enforceMaxSize()
+}
+
+// Returns a row reader for CSV input with an optional header.
+// Rows are either key,score or rank,key,score.
+func csvReader(rd io.Reader) func() (string, float64, error) {
+	cr := csv.NewReader(bufio.NewReader(rd))
+	cr.FieldsPerRecord = -1
+	cr.ReuseRecord = true
+	keyCol, scoreCol := -1, -1
+
+	return func() (string, float64, error) {
+		for {
+			row, err := cr.Read()
+			if err != nil {
+				return "", 0, err
+			}
+			if keyCol < 0 {
+				keyCol, scoreCol = 0, 1
+				if len(row) >= 3 {
+					keyCol, scoreCol = 1, 2
+				}
+				if isCSVHeader(row) {
+					for i, name := range row {
+						switch strings.ToLower(strings.TrimSpace(name)) {
+						case "key":
+							keyCol = i
+						case "score":
+							scoreCol = i
+						}
+					}
+					continue
+				}
+			}
+			if keyCol >= len(row) || scoreCol >= len(row) {
+				return "", 0, fmt.Errorf("expected at least %d columns", max(keyCol, scoreCol)+1)
+			}
+			score, err := strconv.ParseFloat(strings.TrimSpace(row[scoreCol]), 64)
+			if err != nil {
+				return "", 0, err
+			}
+			if err := checkScore(score); err != nil {
+				return "", 0, err
+			}
+			return strings.Clone(row[keyCol]), score, nil
+		}
+	}
+}
+
+// Rejects scores that can't be ranked, NaN compares false with everything
+// and would break the skiplist order.
+func checkScore(score float64) error {
+	if math.IsNaN(score) {
+		return fmt.Errorf("%w: score is NaN", ErrInvalidParams)
+	}
+	return nil
+}
+
+// Reports whether the first CSV row names its columns.
+func isCSVHeader(row []string) bool {
+	for _, name := range row {
+		if strings.EqualFold(strings.TrimSpace(name), "score") {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns a row reader for a JSON array of entries.
+func jsonReader(rd io.Reader) func() (string, float64, error) {
+	dec := json.NewDecoder(bufio.NewReader(rd))
+	started := false
+
+	return func() (string, float64, error) {
+		if !started {
+			tok, err := dec.Token()
+			if err != nil {
+				return "", 0, err
+			}
+			if delim, ok := tok.(json.Delim); !ok || delim != '[' {
+				return "", 0, errors.New("expected a JSON array")
+			}
+			started = true
+		}
+		if !dec.More() {
+			if _, err := dec.Token(); err != nil {
+				return "", 0, err
+			}
+			return "", 0, io.EOF
+		}
+		var e Entry
+		if err := dec.Decode(&e); err != nil {
+			return "", 0, err
+		}
+		return e.Key, e.Score, checkScore(e.Score)
+	}
+}
+
+// Returns a row reader for newline-delimited JSON entries.
+func ndjsonReader(rd io.Reader) func() (string, float64, error) {
+	dec := json.NewDecoder(bufio.NewReader(rd))
+	return func() (string, float64, error) {
+		var e Entry
+		if err := dec.Decode(&e); err != nil {
+			return "", 0, err
+		}
+		return e.Key, e.Score, checkScore(e.Score)
+	}
+}
@@ -0,0 +1,149 @@
+package ranker
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRanker_ExportImport(t *testing.T) {
+	src := New(WithStorageDir(t.TempDir()))
+	assert.NoError(t, src.Start())
+	defer src.Close()
+	assert.NoError(t, src.Update("a", 1))
+	assert.NoError(t, src.Update("b", 3))
+	assert.NoError(t, src.Update("c", 2))
+
+	for _, format := range []Format{FormatCSV, FormatJSON, FormatNDJSON} {
+		var buf bytes.Buffer
+		assert.NoError(t, src.Export(&buf, format))
+
+		dst := New(WithStorageDir(t.TempDir()))
+		assert.NoError(t, dst.Start())
+		assert.NoError(t, dst.Update("stale", 10))
+
+		n, err := dst.Import(&buf, format, ImportReplace)
+		assert.NoError(t, err, format)
+		assert.Equal(t, 3, n)
+		assert.Equal(t, 3, dst.Count())
+		entries, err := dst.Range(0, -1)
+		assert.NoError(t, err)
+		assert.Equal(t, "b", entries[0].Key)
+		assert.Equal(t, "a", entries[2].Key)
+		assert.NoError(t, dst.Verify())
+		dst.Close()
+	}
+}
+
+func TestRanker_ImportReplaceStaged(t *testing.T) {
+	for _, approx := range []bool{false, true} {
+		parent := t.TempDir()
+		dir := filepath.Join(parent, "rank")
+		options := []Option{WithStorageDir(dir)}
+		if approx {
+			options = append(options, WithApproximateRanks(100, 52))
+		}
+		r := New(options...)
+		assert.NoError(t, r.Start())
+		assert.NoError(t, r.Update("stale", 1e9))
+
+		// More rows than fit a batch are staged next to the store.
+		n, err := r.Import(strings.NewReader(csvRows(25000)), FormatCSV, ImportReplace)
+		assert.NoError(t, err)
+		assert.Equal(t, 25000, n)
+		assert.Equal(t, 25000, r.Count())
+		if approx {
+			assert.LessOrEqual(t, r.zset.ZCard(), 100)
+		}
+		entry, err := r.Rank("p24999")
+		assert.NoError(t, err)
+		assert.Equal(t, 0, entry.Rank)
+		_, err = r.Score("stale")
+		assert.ErrorIs(t, err, ErrKeyNotExist)
+		assert.NoError(t, r.Verify())
+
+		// A canceled import leaves the board and no staged directory.
+		ctx, cancel := context.WithCancel(context.Background())
+		rd := &cancelReader{r: strings.NewReader(csvRows(30000)), n: 200000, cancel: cancel}
+		_, err = r.ImportContext(ctx, rd, FormatCSV, ImportReplace)
+		assert.ErrorIs(t, err, context.Canceled)
+		assert.Equal(t, 25000, r.Count())
+		entries, err := os.ReadDir(parent)
+		assert.NoError(t, err)
+		assert.Len(t, entries, 1)
+
+		r.Close()
+		r = New(options...)
+		assert.NoError(t, r.Start())
+		assert.Equal(t, 25000, r.Count(), approx)
+		r.Close()
+	}
+}
+
+func TestRanker_ImportMerge(t *testing.T) {
+	r := New(WithStorageDir(t.TempDir()))
+	assert.NoError(t, r.Start())
+	defer r.Close()
+	assert.NoError(t, r.Update("a", 5))
+	assert.NoError(t, r.Update("b", 5))
+
+	_, err := r.Import(strings.NewReader("key,score\na,3\nb,7\n"), FormatCSV, ImportMergeMax)
+	assert.NoError(t, err)
+	a, _ := r.Rank("a")
+	b, _ := r.Rank("b")
+	assert.Equal(t, float64(5), a.Score)
+	assert.Equal(t, float64(7), b.Score)
+
+	_, err = r.Import(strings.NewReader(`{"key":"a","score":1}`+"\n"+`{"key":"c","score":2}`), FormatNDJSON, ImportMergeSum)
+	assert.NoError(t, err)
+	a, _ = r.Rank("a")
+	c, _ := r.Rank("c")
+	assert.Equal(t, float64(6), a.Score)
+	assert.Equal(t, float64(2), c.Score)
+	assert.NoError(t, r.Verify())
+}
+
+func TestRanker_ImportReplaceMalformed(t *testing.T) {
+	dir := t.TempDir()
+	r := New(WithStorageDir(dir))
+	assert.NoError(t, r.Start())
+	assert.NoError(t, r.Update("a", 1))
+	assert.NoError(t, r.Update("b", 2))
+
+	n, err := r.Import(strings.NewReader("c,3\nd,oops\ne,5\n"), FormatCSV, ImportReplace)
+	assert.ErrorContains(t, err, "row 2")
+	assert.Equal(t, 1, n)
+
+	// The board is untouched, in memory and in the store.
+	assert.Equal(t, 2, r.Count())
+	_, err = r.Score("c")
+	assert.ErrorIs(t, err, ErrKeyNotExist)
+	assert.NoError(t, r.Verify())
+	r.Close()
+
+	r = New(WithStorageDir(dir))
+	assert.NoError(t, r.Start())
+	defer r.Close()
+	entries, err := r.Range(0, -1)
+	assert.NoError(t, err)
+	assert.Equal(t, []*Entry{{Rank: 0, Score: 2, Key: "b"}, {Rank: 1, Score: 1, Key: "a"}}, entries)
+}
+
+func TestRanker_ImportNaN(t *testing.T) {
+	r := New(WithStore(NewMemoryStore()))
+	assert.NoError(t, r.Start())
+	defer r.Close()
+
+	for _, input := range []string{"a,1\nb,NaN\nc,3\n", "key,score\nb,nan\n"} {
+		_, err := r.Import(strings.NewReader(input), FormatCSV, ImportMergeMax)
+		assert.ErrorIs(t, err, ErrInvalidParams, input)
+	}
+	_, err := r.Score("b")
+	assert.ErrorIs(t, err, ErrKeyNotExist)
+	assert.NoError(t, r.Verify())
+}
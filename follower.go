@@ -0,0 +1,232 @@
+package ranker
+
+import (
+	"bufio"
+	"net"
+	"sync"
+	"time"
+)
+
+// Time between attempts to reach the primary after a failure.
+var replRetryInterval = time.Second
+
+// ReplicationStatus describes how far a follower is behind its primary.
+type ReplicationStatus struct {
+	Connected bool          `json:"connected"`  // Whether a stream is established
+	Applied   uint64        `json:"applied"`    // Seq of the last applied change
+	Primary   uint64        `json:"primary"`    // Latest seq known from the primary
+	Lag       uint64        `json:"lag"`        // Changes not applied yet
+	Behind    time.Duration `json:"behind"`     // Time since the follower was last caught up, 0 when it is
+	FullSyncs int           `json:"full_syncs"` // Snapshots received so far
+}
+
+// Follower keeps a Ranker in step with a primary served by
+// ServeReplication. The follower's state is replaced by a snapshot of the
+// primary when it first connects, then every change is applied in order
+// through the regular write methods. A follower that falls behind the
+// primary's backlog resyncs from a new snapshot.
+//
+// The Ranker should not be written to otherwise, such writes are lost on
+// the next resync. The replication position is not persisted, so a
+// restarted follower starts with a full sync.
+type Follower struct {
+	r    *Ranker
+	addr string
+
+	mu        sync.Mutex
+	conn      net.Conn
+	id        string    // History id of the primary
+	seq       uint64    // Last applied seq
+	primary   uint64    // Latest seq known from the primary
+	caughtUp  time.Time // Last time seq reached primary
+	fullSyncs int
+	closed    bool
+
+	done chan struct{}
+	wg   sync.WaitGroup
+}
+
+// Creates a follower replicating the primary at addr into r.
+func NewFollower(r *Ranker, addr string) *Follower {
+	return &Follower{r: r, addr: addr, done: make(chan struct{})}
+}
+
+// Starts replicating in the background, reconnecting after failures.
+// The Ranker must be started.
+func (f *Follower) Start() {
+	f.wg.Add(1)
+	go f.run()
+}
+
+// Stops replicating and waits for the background work to finish.
+func (f *Follower) Close() {
+	f.mu.Lock()
+	if f.closed {
+		f.mu.Unlock()
+		return
+	}
+	f.closed = true
+	close(f.done)
+	if f.conn != nil {
+		f.conn.Close()
+	}
+	f.mu.Unlock()
+	f.wg.Wait()
+}
+
+// Returns the replication position and lag.
+func (f *Follower) Status() ReplicationStatus {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	status := ReplicationStatus{
+		Connected: f.conn != nil,
+		Applied:   f.seq,
+		Primary:   max(f.primary, f.seq),
+		FullSyncs: f.fullSyncs,
+	}
+	status.Lag = status.Primary - f.seq
+	if status.Lag > 0 {
+		status.Behind = time.Since(f.caughtUp)
+	}
+	return status
+}
+
+func (f *Follower) run() {
+	defer f.wg.Done()
+	select {
+	case <-f.done:
+		return
+	case <-f.r.Ready():
+	}
+	if err := f.r.LoadError(); err != nil {
+		f.r.logger.Error("replication not started", "id", f.r.ID, "primary", f.addr, "err", err)
+		return
+	}
+	for {
+		err := f.stream()
+		select {
+		case <-f.done:
+			return
+		case <-time.After(replRetryInterval):
+		}
+		f.r.logger.Warn("replication stream lost", "id", f.r.ID, "primary", f.addr, "err", err)
+	}
+}
+
+// Connects to the primary and applies its stream until either side fails.
+func (f *Follower) stream() error {
+	conn, err := net.DialTimeout("tcp", f.addr, 3*replPingInterval)
+	if err != nil {
+		return err
+	}
+	f.mu.Lock()
+	if f.closed {
+		f.mu.Unlock()
+		conn.Close()
+		return ErrStoreClosed
+	}
+	f.conn = conn
+	id, seq := f.id, f.seq
+	f.mu.Unlock()
+	defer func() {
+		f.mu.Lock()
+		f.conn = nil
+		f.mu.Unlock()
+		conn.Close()
+	}()
+
+	bw := bufio.NewWriter(conn)
+	writeReplHandshake(bw, id, seq)
+	if err := bw.Flush(); err != nil {
+		return err
+	}
+
+	br := bufio.NewReader(conn)
+	for {
+		conn.SetReadDeadline(time.Now().Add(3 * replPingInterval))
+		kind, err := br.ReadByte()
+		if err != nil {
+			return err
+		}
+
+		switch kind {
+		case replFullSync:
+			id, seq, z, err := readReplFullSync(br)
+			if err != nil {
+				return err
+			}
+			if err := f.r.replaceAll(z); err != nil {
+				return err
+			}
+			f.mu.Lock()
+			f.id = id
+			f.fullSyncs++
+			f.primary = seq // The primary may have restarted with a lower seq
+			f.advance(seq, seq)
+			f.mu.Unlock()
+
+		case replChange:
+			c, err := readReplChange(br)
+			if err != nil {
+				return err
+			}
+			f.mu.Lock()
+			expected := f.seq + 1
+			f.mu.Unlock()
+			if c.Seq != expected {
+				return errReplProtocol
+			}
+			if err := f.apply(c); err != nil {
+				return err
+			}
+			f.mu.Lock()
+			f.advance(c.Seq, c.Seq)
+			f.mu.Unlock()
+
+		case replPing:
+			latest, err := readUint64(br)
+			if err != nil {
+				return err
+			}
+			f.mu.Lock()
+			f.advance(f.seq, latest)
+			seq := f.seq
+			f.mu.Unlock()
+			bw.WriteByte(replAck)
+			writeUint64(bw, seq)
+			if err := bw.Flush(); err != nil {
+				return err
+			}
+
+		default:
+			return errReplProtocol
+		}
+	}
+}
+
+// Records the applied and known primary seq, the caller holds f.mu.
+func (f *Follower) advance(seq, primary uint64) {
+	f.seq = seq
+	f.primary = max(f.primary, primary)
+	if f.seq >= f.primary {
+		f.primary = f.seq
+		f.caughtUp = time.Now()
+	}
+}
+
+// Applies a change through the Ranker's write methods.
+func (f *Follower) apply(c Change) error {
+	switch c.Op {
+	case ChangeSet:
+		return f.r.Update(c.Key, c.Value)
+	case ChangeIncr:
+		_, err := f.r.IncrBy(c.Key, c.Value)
+		return err
+	case ChangeRemove:
+		if err := f.r.Remove(c.Key); err != nil && err != ErrKeyNotExist {
+			return err
+		}
+		return nil
+	}
+	return errReplProtocol
+}
@@ -0,0 +1,213 @@
+package ranker
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"hash"
+	"hash/crc32"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+)
+
+const (
+	imageFileName = "RANKER-IMAGE" // Sorted image of the ZSet, next to the Pebble files
+	imageMagic    = "RKIMG001"     // Identifies the image file and its layout version
+)
+
+var (
+	errImageCorrupt = errors.New("ranker image is corrupt")
+	crcTable        = crc32.MakeTable(crc32.Castagnoli)
+)
+
+// Returns the path of the ZSet image next to the Pebble files, or "" for
+// other stores.
+func (r *Ranker) imagePath() string {
+	ps, ok := r.store.(*PebbleStore)
+	if !ok || r.approx != nil {
+		// An approximate Ranker only holds its head in the ZSet.
+		return ""
+	}
+	return filepath.Join(ps.Dir(), imageFileName)
+}
+
+// Writes the ZSet in rank order so the next Start can bulk-build it.
+//
+// Layout: magic, uint64 count, then per member a uvarint length, the member
+// bytes and the score as 8 little-endian bytes, followed by a CRC-32C of all
+// preceding bytes.
+func (r *Ranker) writeImage() error {
+	path := r.imagePath()
+	if path == "" {
+		return nil
+	}
+	return writeFileAtomic(path, func(w io.Writer) error {
+		return writeImage(w, r.zset)
+	})
+}
+
+// Writes a file through fn into a temporary name and renames it into place,
+// so a crash never leaves a truncated file behind.
+func writeFileAtomic(path string, fn func(w io.Writer) error) error {
+	tmp := path + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp)
+
+	if err := fn(f); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return err
+	}
+	return syncDir(filepath.Dir(path))
+}
+
+// Encodes the members of z in ascending (score, member) order.
+func writeImage(w io.Writer, z *ZSet) error {
+	crc := crc32.New(crcTable)
+	bw := bufio.NewWriter(io.MultiWriter(w, crc))
+
+	var buf [binary.MaxVarintLen64]byte
+	bw.WriteString(imageMagic)
+	binary.LittleEndian.PutUint64(buf[:8], uint64(z.zset.zsl.length))
+	bw.Write(buf[:8])
+
+	for x := z.zset.zsl.head.level[0].forward; x != nil; x = x.level[0].forward {
+		n := binary.PutUvarint(buf[:], uint64(len(x.member)))
+		bw.Write(buf[:n])
+		bw.WriteString(x.member)
+		binary.LittleEndian.PutUint64(buf[:8], math.Float64bits(x.score))
+		if _, err := bw.Write(buf[:8]); err != nil {
+			return err
+		}
+	}
+	if err := bw.Flush(); err != nil {
+		return err
+	}
+
+	binary.LittleEndian.PutUint32(buf[:4], crc.Sum32())
+	_, err := w.Write(buf[:4])
+	return err
+}
+
+// Builds a ZSet from an image written by writeImage in O(N).
+// Any framing, ordering or checksum problem returns errImageCorrupt.
+func readImage(r io.Reader) (*ZSet, error) {
+	br := bufio.NewReader(r)
+	tr := &crcReader{r: br, crc: crc32.New(crcTable)}
+
+	var buf [8]byte
+	magic := make([]byte, len(imageMagic))
+	if _, err := io.ReadFull(tr, magic); err != nil || string(magic) != imageMagic {
+		return nil, errImageCorrupt
+	}
+	if _, err := io.ReadFull(tr, buf[:8]); err != nil {
+		return nil, errImageCorrupt
+	}
+	count := binary.LittleEndian.Uint64(buf[:8])
+
+	b := newZSkipListBuilder(newZSkipList())
+	dict := make(map[string]*zskiplistNode, min(count, 1<<20))
+	var member []byte
+	for i := uint64(0); i < count; i++ {
+		n, err := binary.ReadUvarint(tr)
+		if err != nil || n > math.MaxInt32 {
+			return nil, errImageCorrupt
+		}
+		if uint64(cap(member)) < n {
+			member = make([]byte, n)
+		}
+		member = member[:n]
+		if _, err := io.ReadFull(tr, member); err != nil {
+			return nil, errImageCorrupt
+		}
+		if _, err := io.ReadFull(tr, buf[:8]); err != nil {
+			return nil, errImageCorrupt
+		}
+		score := math.Float64frombits(binary.LittleEndian.Uint64(buf[:8]))
+		key := string(member)
+		if !b.after(score, key) {
+			return nil, errImageCorrupt
+		}
+		dict[key] = b.append(score, key)
+	}
+
+	// The checksum is not part of the summed bytes, so read it directly.
+	sum := tr.crc.Sum32()
+	rest, _ := io.ReadAll(br)
+	if len(rest) != 4 {
+		return nil, errImageCorrupt
+	}
+	if binary.LittleEndian.Uint32(rest) != sum {
+		return nil, errImageCorrupt
+	}
+
+	return &ZSet{zset: &zset{dict: dict, zsl: b.finish()}}, nil
+}
+
+// crcReader checksums every byte read through it.
+type crcReader struct {
+	r   *bufio.Reader
+	crc hash.Hash32
+}
+
+func (c *crcReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.crc.Write(p[:n])
+	return n, err
+}
+
+func (c *crcReader) ReadByte() (byte, error) {
+	b, err := c.r.ReadByte()
+	if err == nil {
+		c.crc.Write([]byte{b})
+	}
+	return b, err
+}
+
+// Loads the ZSet from the image file, reporting whether it was usable.
+// The image is removed afterwards: once writes resume it no longer matches
+// Pebble, and only a clean Close writes a fresh one.
+func (r *Ranker) loadImage() (*ZSet, bool) {
+	path := r.imagePath()
+	if path == "" {
+		return nil, false
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, false
+	}
+	z, err := readImage(f)
+	f.Close()
+
+	if err := os.Remove(path); err == nil {
+		syncDir(filepath.Dir(path))
+	}
+	if err != nil {
+		return nil, false
+	}
+	return z, true
+}
+
+// Flushes directory entries so renames and removals survive a crash.
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
@@ -0,0 +1,94 @@
+package ranker
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestImage_RoundTrip(t *testing.T) {
+	z := NewZSet()
+	for i := 0; i < 1000; i++ {
+		z.ZAdd(float64(i%37), strconv.Itoa(i))
+	}
+
+	var buf bytes.Buffer
+	assert.NoError(t, writeImage(&buf, z))
+	loaded, err := readImage(bytes.NewReader(buf.Bytes()))
+	assert.NoError(t, err)
+	assert.Equal(t, z.ZCard(), loaded.ZCard())
+
+	want, _ := z.ZRangeWithScores(0, -1)
+	got, _ := loaded.ZRangeWithScores(0, -1)
+	assert.Equal(t, want, got)
+	for i := 0; i < 1000; i += 7 {
+		rank, err := loaded.ZRank(strconv.Itoa(i))
+		assert.NoError(t, err)
+		expected, _ := z.ZRank(strconv.Itoa(i))
+		assert.Equal(t, expected, rank)
+	}
+
+	data := buf.Bytes()
+	data[len(data)/2] ^= 0xff
+	_, err = readImage(bytes.NewReader(data))
+	assert.ErrorIs(t, err, errImageCorrupt)
+}
+
+func TestRanker_StartFromImage(t *testing.T) {
+	dir := t.TempDir()
+	r := New(WithStorageDir(dir))
+	assert.NoError(t, r.Start())
+	assert.NoError(t, r.Update("a", 1))
+	assert.NoError(t, r.Update("b", 2))
+	r.Close()
+
+	image := filepath.Join(dir, imageFileName)
+	_, err := os.Stat(image)
+	assert.NoError(t, err)
+
+	r = New(WithStorageDir(dir))
+	assert.NoError(t, r.Start())
+	_, err = os.Stat(image)
+	assert.True(t, os.IsNotExist(err))
+	assert.Equal(t, 2, r.Count())
+	assert.NoError(t, r.Verify())
+	r.Close()
+
+	// A corrupt image falls back to replaying Pebble.
+	assert.NoError(t, os.WriteFile(image, []byte("garbage"), 0644))
+	r = New(WithStorageDir(dir))
+	assert.NoError(t, r.Start())
+	assert.Equal(t, 2, r.Count())
+	assert.NoError(t, r.Verify())
+	r.Close()
+}
+
+func TestRanker_NoImageAfterFailedLoad(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "rank")
+	r := New(WithStorageDir(dir))
+	assert.NoError(t, r.Start())
+	_, err := r.Import(strings.NewReader(csvRows(5000)), FormatCSV, ImportReplace)
+	assert.NoError(t, err)
+	r.Close()
+	assert.NoError(t, os.Remove(filepath.Join(dir, imageFileName)))
+
+	// A canceled load leaves an empty board, which must not become the image.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	r = New(WithStorageDir(dir))
+	assert.ErrorIs(t, r.StartContext(ctx), context.Canceled)
+	r.Close()
+	_, err = os.Stat(filepath.Join(dir, imageFileName))
+	assert.True(t, os.IsNotExist(err))
+
+	r = New(WithStorageDir(dir))
+	assert.NoError(t, r.Start())
+	defer r.Close()
+	assert.Equal(t, 5000, r.Count())
+}
@@ -0,0 +1,130 @@
+package ranker
+
+import "iter"
+
+const iterChunkSize = 256 // Entries collected per lock acquisition by the iterators
+
+// Returns an iterator over the whole leaderboard in rank order, best first.
+//
+// Like the other iterators, it reads the board in chunks and only holds the
+// read lock while collecting a chunk, so the loop body may call the Ranker.
+// Each chunk resumes after the last yielded player's score and ID, so a
+// player moved by a concurrent write may be seen twice or not at all, and
+// ranks are as of the chunk they were read in. A failure, such as
+// ErrWarming, is yielded as the only error and ends the iteration. With
+// WithApproximateRanks only the head is covered, like Range.
+func (r *Ranker) All() iter.Seq2[*Entry, error] {
+	return r.walk(false, func() (*zskiplistNode, int) {
+		return r.zset.zset.zsl.tail, 0
+	}, nil)
+}
+
+// Returns an iterator over the whole leaderboard in reverse rank order,
+// lowest score first.
+func (r *Ranker) Backward() iter.Seq2[*Entry, error] {
+	return r.walk(true, func() (*zskiplistNode, int) {
+		return r.zset.zset.zsl.head.level[0].forward, r.zset.ZCard() - 1
+	}, nil)
+}
+
+// Returns an iterator over the entries ranked start to end inclusive, in
+// rank order. Negative ranks count from the end and are resolved each time
+// an iteration starts.
+func (r *Ranker) RangeByRank(start, end int) iter.Seq2[*Entry, error] {
+	return func(yield func(*Entry, error) bool) {
+		first, last := start, end
+		r.walk(false, func() (*zskiplistNode, int) {
+			length := r.zset.ZCard()
+			if first < 0 {
+				first = max(first+length, 0)
+			}
+			if last < 0 {
+				last += length
+			}
+			if first >= length {
+				return nil, 0
+			}
+			return r.zset.zset.zsl.getNodeByRank(uint64(length - first)), first
+		}, func(x *zskiplistNode, rank int) bool {
+			return rank > last
+		})(yield)
+	}
+}
+
+// Returns an iterator over the players with a score between min and max
+// inclusive, in rank order.
+func (r *Ranker) RangeByScore(min, max float64) iter.Seq2[*Entry, error] {
+	return r.walk(false, func() (*zskiplistNode, int) {
+		zsl := r.zset.zset.zsl
+		x, rank := zsl.lastBelowScore(max, true)
+		if x == zsl.head {
+			return nil, 0
+		}
+		return x, int(zsl.length) - int(rank)
+	}, func(x *zskiplistNode, rank int) bool {
+		return x.score < min
+	})
+}
+
+// Walks the ZSet in rank order, or reverse rank order when reverse is set,
+// from the node returned by seek until done reports true; a nil done never
+// stops early. Both run with the read lock held.
+func (r *Ranker) walk(reverse bool, seek func() (*zskiplistNode, int), done func(x *zskiplistNode, rank int) bool) iter.Seq2[*Entry, error] {
+	return func(yield func(*Entry, error) bool) {
+		var last *Entry
+		for {
+			r.mu.RLock()
+			if err := r.checkReady(); err != nil {
+				r.mu.RUnlock()
+				yield(nil, err)
+				return
+			}
+			var x *zskiplistNode
+			var rank int
+			if last == nil {
+				x, rank = seek()
+			} else {
+				x, rank = r.resume(last, reverse)
+			}
+
+			chunk := make([]*Entry, 0, iterChunkSize)
+			for x != nil && len(chunk) < iterChunkSize && (done == nil || !done(x, rank)) {
+				chunk = append(chunk, &Entry{Rank: rank, Score: x.score, Key: x.member})
+				if reverse {
+					x, rank = x.level[0].forward, rank-1
+				} else {
+					x, rank = x.backward, rank+1
+				}
+			}
+			more := x != nil && (done == nil || !done(x, rank))
+			r.mu.RUnlock()
+
+			for _, entry := range chunk {
+				if !yield(entry, nil) {
+					return
+				}
+			}
+			if !more {
+				return
+			}
+			last = chunk[len(chunk)-1]
+		}
+	}
+}
+
+// Finds the node following last in the walk direction and its rank, the
+// caller holds the lock.
+func (r *Ranker) resume(last *Entry, reverse bool) (*zskiplistNode, int) {
+	zsl := r.zset.zset.zsl
+	if reverse {
+		// The first node after last in ascending order.
+		x, rank := zsl.lastBefore(last.Score, last.Key, true)
+		return x.level[0].forward, int(zsl.length) - int(rank) - 1
+	}
+	// The last node before last in ascending order.
+	x, rank := zsl.lastBefore(last.Score, last.Key, false)
+	if x == zsl.head {
+		return nil, 0
+	}
+	return x, int(zsl.length) - int(rank)
+}
@@ -0,0 +1,109 @@
+package ranker
+
+import (
+	"fmt"
+	"iter"
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Collects the entries of a sequence, failing on errors.
+func seqEntries(t *testing.T, seq iter.Seq2[*Entry, error]) []*Entry {
+	var entries []*Entry
+	for entry, err := range seq {
+		assert.NoError(t, err)
+		entries = append(entries, entry)
+	}
+	return entries
+}
+
+func TestRanker_Iterators(t *testing.T) {
+	r := New(WithStore(NewMemoryStore()))
+	assert.NoError(t, r.Start())
+	defer r.Close()
+	// Enough players for several chunks, with ties across chunk boundaries.
+	n := 3*iterChunkSize + 17
+	for i := 0; i < n; i++ {
+		assert.NoError(t, r.Update(fmt.Sprintf("p%04d", i), float64(i/7)))
+	}
+
+	all, err := r.Range(0, -1)
+	assert.NoError(t, err)
+	assert.Equal(t, all, seqEntries(t, r.All()))
+
+	backward := seqEntries(t, r.Backward())
+	assert.Len(t, backward, n)
+	for i, entry := range backward {
+		assert.Equal(t, all[n-1-i], entry)
+	}
+
+	for _, b := range [][2]int{{0, -1}, {10, 600}, {-300, -1}, {n - 1, n + 5}, {5, 2}, {n, n + 1}} {
+		expected, err := r.Range(b[0], b[1])
+		assert.NoError(t, err)
+		assert.Equal(t, len(expected), len(seqEntries(t, r.RangeByRank(b[0], b[1]))), b)
+		if len(expected) > 0 {
+			assert.Equal(t, expected, seqEntries(t, r.RangeByRank(b[0], b[1])), b)
+		}
+	}
+
+	// Negative bounds are resolved again on every run of the same sequence.
+	tail := r.RangeByRank(-2, -1)
+	assert.Equal(t, all[n-2:], seqEntries(t, tail))
+	assert.NoError(t, r.Update("last", -1))
+	entries := seqEntries(t, tail)
+	assert.Len(t, entries, 2)
+	assert.Equal(t, "last", entries[1].Key)
+	assert.NoError(t, r.Remove("last"))
+
+	byScore := seqEntries(t, r.RangeByScore(10, 50))
+	count, err := r.CountByScore(10, 50)
+	assert.NoError(t, err)
+	assert.Len(t, byScore, count)
+	for _, entry := range byScore {
+		assert.Equal(t, all[entry.Rank], entry)
+	}
+	assert.Len(t, seqEntries(t, r.RangeByScore(math.Inf(-1), math.Inf(1))), n)
+	assert.Empty(t, seqEntries(t, r.RangeByScore(1e9, 2e9)))
+}
+
+func TestRanker_IteratorWrites(t *testing.T) {
+	r := New(WithStore(NewMemoryStore()))
+	assert.NoError(t, r.Start())
+	defer r.Close()
+	n := 2 * iterChunkSize
+	for i := 0; i < n; i++ {
+		assert.NoError(t, r.Update(fmt.Sprintf("p%04d", i), float64(i)))
+	}
+
+	// The loop body may write, and removing what was seen doesn't skip
+	// anything that follows.
+	seen := 0
+	for entry, err := range r.All() {
+		assert.NoError(t, err)
+		assert.NoError(t, r.Remove(entry.Key))
+		seen++
+	}
+	assert.Equal(t, n, seen)
+	assert.Equal(t, 0, r.Count())
+
+	// Breaking out stops the iteration.
+	assert.NoError(t, r.Update("a", 1))
+	assert.NoError(t, r.Update("b", 2))
+	for entry := range r.All() {
+		assert.Equal(t, "b", entry.Key)
+		break
+	}
+}
+
+func TestRanker_IteratorWarming(t *testing.T) {
+	r := New(WithStore(NewMemoryStore()))
+	r.warming = true
+	var errs []error
+	for entry, err := range r.All() {
+		assert.Nil(t, entry)
+		errs = append(errs, err)
+	}
+	assert.Equal(t, []error{ErrWarming}, errs)
+}
@@ -0,0 +1,140 @@
+package ranker
+
+import (
+	"cmp"
+	"container/heap"
+	"context"
+	"iter"
+	"slices"
+	"sync"
+	"sync/atomic"
+)
+
+// Configures how many goroutines read the store's keyspace during Start.
+// Defaults to GOMAXPROCS; values below 1 are treated as 1.
+func WithLoadConcurrency(n int) Option {
+	return func(r *Ranker) {
+		r.loadConcurrency = max(n, 1)
+	}
+}
+
+// loadItem is a decoded store record.
+type loadItem struct {
+	member string
+	score  float64
+}
+
+// Reads all stored records into a new ZSet.
+//
+// The keyspace is split into ranges that are read and decoded in parallel,
+// each range is sorted by (score, member) on its own goroutine, and the
+// sorted runs are merged straight into a bulk skiplist build.
+func (r *Ranker) loadData(ctx context.Context) (*ZSet, error) {
+	ranges, err := r.loadRanges(r.loadConcurrency)
+	if err != nil {
+		return nil, err
+	}
+
+	runs := make([][]loadItem, len(ranges))
+	errs := make([]error, len(ranges))
+	var read atomic.Int64
+	var wg sync.WaitGroup
+	for i, kr := range ranges {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			runs[i], errs[i] = r.readRange(ctx, kr, &read)
+		}()
+	}
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			return nil, err
+		}
+	}
+	return NewZSetFromSorted(mergeRuns(runs))
+}
+
+// Reads and sorts the records of one key range, adding to the count of
+// records read by all ranges and stopping once ctx is done.
+func (r *Ranker) readRange(ctx context.Context, kr KeyRange, read *atomic.Int64) ([]loadItem, error) {
+	var items []loadItem
+	err := r.store.Iterate(kr.Lower, kr.Upper, func(key, value []byte) error {
+		items = append(items, loadItem{
+			member: string(key), // The store may reuse its key buffer
+			score:  bytesToFloat64(value),
+		})
+		n := read.Add(1)
+		if n%loadProgressInterval == 0 {
+			r.logger.Info("load progress", "id", r.ID, "records", n)
+		}
+		return checkCanceled(ctx, int(n))
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	slices.SortFunc(items, func(a, b loadItem) int {
+		if c := cmp.Compare(a.score, b.score); c != 0 {
+			return c
+		}
+		return cmp.Compare(a.member, b.member)
+	})
+	return items, nil
+}
+
+// Splits the keyspace for loading, as a single range unless the store
+// implements Splitter.
+func (r *Ranker) loadRanges(n int) ([]KeyRange, error) {
+	if splitter, ok := r.store.(Splitter); ok && n > 1 {
+		return splitter.Split(n)
+	}
+	return []KeyRange{{}}, nil
+}
+
+// runHeap orders the heads of sorted runs by (score, member).
+type runHeap struct {
+	runs [][]loadItem
+	idx  []int // Indices into runs, kept as a heap
+}
+
+func (h *runHeap) Len() int { return len(h.idx) }
+func (h *runHeap) Less(i, j int) bool {
+	a, b := h.runs[h.idx[i]][0], h.runs[h.idx[j]][0]
+	return a.score < b.score || (a.score == b.score && a.member < b.member)
+}
+func (h *runHeap) Swap(i, j int) { h.idx[i], h.idx[j] = h.idx[j], h.idx[i] }
+func (h *runHeap) Push(x any)    { h.idx = append(h.idx, x.(int)) }
+func (h *runHeap) Pop() any {
+	x := h.idx[len(h.idx)-1]
+	h.idx = h.idx[:len(h.idx)-1]
+	return x
+}
+
+// Merges sorted runs into a single ascending sequence of member, score.
+func mergeRuns(runs [][]loadItem) iter.Seq2[string, float64] {
+	return func(yield func(string, float64) bool) {
+		h := &runHeap{runs: runs}
+		for i, run := range runs {
+			if len(run) > 0 {
+				h.idx = append(h.idx, i)
+			}
+		}
+		heap.Init(h)
+
+		for h.Len() > 0 {
+			i := h.idx[0]
+			item := runs[i][0]
+			if !yield(item.member, item.score) {
+				return
+			}
+			runs[i] = runs[i][1:]
+			if len(runs[i]) == 0 {
+				heap.Pop(h)
+			} else {
+				heap.Fix(h, 0)
+			}
+		}
+	}
+}
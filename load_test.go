@@ -0,0 +1,56 @@
+package ranker
+
+import (
+	"math/rand"
+	"strconv"
+	"testing"
+
+	"github.com/cockroachdb/pebble"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+// Writes n random players straight to Pebble and flushes them to sstables,
+// like the store example/main.go produces.
+func makeStore(tb testing.TB, dir string, n int) {
+	db, err := pebble.Open(dir, &pebble.Options{MemTableSize: 4 << 20})
+	assert.NoError(tb, err)
+	batch := db.NewBatch()
+	for i := 0; i < n; i++ {
+		batch.Set([]byte(uuid.NewString()), float64ToBytes(rand.Float64()*1000), nil)
+		if batch.Len() > 1<<20 {
+			assert.NoError(tb, batch.Commit(pebble.NoSync))
+			batch = db.NewBatch()
+		}
+	}
+	assert.NoError(tb, batch.Commit(pebble.NoSync))
+	assert.NoError(tb, db.Flush())
+	assert.NoError(tb, db.Close())
+}
+
+func TestRanker_ParallelLoad(t *testing.T) {
+	dir := t.TempDir()
+	makeStore(t, dir, 50000)
+
+	serial := New(WithStorageDir(dir), WithLoadConcurrency(1))
+	assert.NoError(t, serial.Start())
+	want, err := serial.Range(0, -1)
+	assert.NoError(t, err)
+	serial.store.Close()
+	serial.store = nil
+
+	for _, n := range []int{2, 4, 16} {
+		r := New(WithStorageDir(dir), WithLoadConcurrency(n))
+		assert.NoError(t, r.Start())
+		ranges, err := r.loadRanges(n)
+		assert.NoError(t, err)
+		assert.LessOrEqual(t, len(ranges), n)
+
+		got, err := r.Range(0, -1)
+		assert.NoError(t, err)
+		assert.Equal(t, want, got, strconv.Itoa(n))
+		assert.NoError(t, r.zset.zset.zsl.validate())
+		r.store.Close()
+		r.store = nil
+	}
+}
@@ -0,0 +1,110 @@
+package ranker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"time"
+
+	"github.com/cockroachdb/pebble"
+)
+
+const (
+	defaultSlowThreshold = 100 * time.Millisecond // Operations taking longer are logged
+	loadProgressInterval = 1 << 20                // Records read between load progress events
+)
+
+// Configures the logger receiving structured events about startup, loading,
+// storage and slow operations. The default logger discards everything.
+func WithLogger(logger *slog.Logger) Option {
+	return func(r *Ranker) {
+		if logger != nil {
+			r.logger = logger
+		}
+	}
+}
+
+// Configures how long an operation may take, including waiting for the
+// lock, before it is logged as slow and recorded in the slowlog. Zero or
+// less disables both.
+func WithSlowThreshold(d time.Duration) Option {
+	return func(r *Ranker) {
+		r.slowThreshold = d
+	}
+}
+
+// discardHandler is a slog.Handler that drops every record.
+type discardHandler struct{}
+
+func (discardHandler) Enabled(context.Context, slog.Level) bool  { return false }
+func (discardHandler) Handle(context.Context, slog.Record) error { return nil }
+func (h discardHandler) WithAttrs([]slog.Attr) slog.Handler      { return h }
+func (h discardHandler) WithGroup(string) slog.Handler           { return h }
+
+// Errors that are part of normal operation and not worth logging.
+var expectedErrors = []error{ErrKeyNotExist, ErrInvalidParams, ErrWarming, ErrNotLeader}
+
+func isExpected(err error) bool {
+	for _, expected := range expectedErrors {
+		if errors.Is(err, expected) {
+			return true
+		}
+	}
+	return false
+}
+
+// Builds the options of the Pebble store opened by Start, forwarding its
+// log output and significant events to the logger.
+func (r *Ranker) pebbleOptions() *pebble.Options {
+	logger := r.logger.With("component", "pebble")
+	return &pebble.Options{
+		Logger: pebbleLogger{logger},
+		EventListener: &pebble.EventListener{
+			BackgroundError: func(err error) {
+				logger.Error("background error", "err", err)
+			},
+			CompactionEnd: func(info pebble.CompactionInfo) {
+				if info.Err != nil {
+					logger.Error("compaction failed", "job", info.JobID, "reason", info.Reason, "err", info.Err)
+					return
+				}
+				logger.Info("compaction", "job", info.JobID, "reason", info.Reason,
+					"level", info.Output.Level, "tables", len(info.Output.Tables), "duration", info.TotalDuration)
+			},
+			FlushEnd: func(info pebble.FlushInfo) {
+				if info.Err != nil {
+					logger.Error("flush failed", "job", info.JobID, "reason", info.Reason, "err", info.Err)
+					return
+				}
+				logger.Debug("flush", "job", info.JobID, "reason", info.Reason,
+					"bytes", info.InputBytes, "duration", info.TotalDuration)
+			},
+			DiskSlow: func(info pebble.DiskSlowInfo) {
+				logger.Warn("disk slow", "path", info.Path, "op", info.OpType.String(), "duration", info.Duration)
+			},
+			WriteStallBegin: func(info pebble.WriteStallBeginInfo) {
+				logger.Warn("write stall", "reason", info.Reason)
+			},
+			WriteStallEnd: func() {
+				logger.Info("write stall ended")
+			},
+		},
+	}
+}
+
+// pebbleLogger adapts a slog.Logger to the Pebble logger interface.
+type pebbleLogger struct {
+	logger *slog.Logger
+}
+
+func (l pebbleLogger) Infof(format string, args ...any) {
+	l.logger.Info(fmt.Sprintf(format, args...))
+}
+
+// Logs the message and exits, like the default Pebble logger.
+func (l pebbleLogger) Fatalf(format string, args ...any) {
+	l.logger.Error(fmt.Sprintf(format, args...))
+	os.Exit(1)
+}
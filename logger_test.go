@@ -0,0 +1,83 @@
+package ranker
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Decodes the records written by a JSON slog handler.
+func logRecords(t *testing.T, buf *bytes.Buffer) []map[string]any {
+	var records []map[string]any
+	dec := json.NewDecoder(buf)
+	for dec.More() {
+		var record map[string]any
+		assert.NoError(t, dec.Decode(&record))
+		records = append(records, record)
+	}
+	return records
+}
+
+// Returns the first record with the given message.
+func findRecord(records []map[string]any, msg string) map[string]any {
+	for _, record := range records {
+		if record["msg"] == msg {
+			return record
+		}
+	}
+	return nil
+}
+
+func TestRanker_WithLogger(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "rank")
+	r := New(WithStorageDir(dir))
+	assert.NoError(t, r.Start())
+	assert.NoError(t, r.Update("a", 1))
+	assert.NoError(t, r.Update("b", 2))
+	r.Close()
+
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	r = New(WithID("board"), WithStorageDir(dir), WithLogger(logger), WithSlowThreshold(time.Nanosecond))
+	assert.NoError(t, r.Start())
+	_, err := r.Rank("a")
+	assert.NoError(t, err)
+	_, err = r.Rank("missing")
+	assert.ErrorIs(t, err, ErrKeyNotExist)
+	r.Close()
+
+	records := logRecords(t, &buf)
+	started := findRecord(records, "ranker started")
+	if assert.NotNil(t, started) {
+		assert.Equal(t, "board", started["id"])
+		assert.Equal(t, float64(2), started["players"])
+	}
+	slow := findRecord(records, "slow operation")
+	if assert.NotNil(t, slow) {
+		assert.Equal(t, opRank, slow["op"])
+		assert.Equal(t, "a", slow["player"])
+	}
+	// A missing player is not a failure worth logging.
+	assert.Nil(t, findRecord(records, "operation failed"))
+}
+
+func TestRanker_LogStoreErrors(t *testing.T) {
+	var buf bytes.Buffer
+	store := NewMemoryStore()
+	r := New(WithStore(store), WithLogger(slog.New(slog.NewJSONHandler(&buf, nil))))
+	assert.NoError(t, r.Start())
+	defer r.Close()
+
+	store.Close()
+	assert.ErrorIs(t, r.Update("a", 1), ErrStoreClosed)
+	failed := findRecord(logRecords(t, &buf), "operation failed")
+	if assert.NotNil(t, failed) {
+		assert.Equal(t, opUpdate, failed["op"])
+		assert.Equal(t, ErrStoreClosed.Error(), failed["err"])
+	}
+}
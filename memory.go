@@ -0,0 +1,130 @@
+package ranker
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"time"
+)
+
+// Configures a pure in-memory Ranker: the ZSet is the only copy of the
+// leaderboard and writes skip the store entirely. Data is lost on restart
+// unless WithSnapshotFile is used. Start always loads synchronously in this
+// mode, WithAsyncStart is ignored.
+func WithoutPersistence() Option {
+	return func(r *Ranker) {
+		r.ephemeral = true
+		r.openStore = func() (Store, error) {
+			return discardStore{}, nil
+		}
+	}
+}
+
+// Configures a file the in-memory leaderboard is snapshotted to every
+// interval and on Close, and restored from on Start. Writes made after the
+// last snapshot are lost on a crash, so the restored state is approximate.
+// An interval of 0 only snapshots on Close. Only used with WithoutPersistence.
+func WithSnapshotFile(path string, interval time.Duration) Option {
+	return func(r *Ranker) {
+		r.snapshotPath = path
+		r.snapshotInterval = interval
+	}
+}
+
+// Restores the snapshot file and starts the snapshot loop.
+func (r *Ranker) startEphemeral() error {
+	if r.snapshotPath == "" {
+		return nil
+	}
+	z, err := readSnapshotFile(r.snapshotPath)
+	if err != nil {
+		return err
+	}
+	if z != nil {
+		r.zset = z
+	}
+
+	if r.snapshotInterval > 0 {
+		r.stop = make(chan struct{})
+		r.background.Add(1)
+		go r.snapshotLoop()
+	}
+	return nil
+}
+
+// Reads a snapshot file, returning a nil set when it doesn't exist.
+func readSnapshotFile(path string) (*ZSet, error) {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return readImage(f)
+}
+
+// Saves a snapshot every interval until Close.
+func (r *Ranker) snapshotLoop() {
+	defer r.background.Done()
+	ticker := time.NewTicker(r.snapshotInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-r.stop:
+			return
+		case <-ticker.C:
+			if err := r.saveSnapshot(); err != nil {
+				r.logger.Error("failed to save snapshot", "id", r.ID, "path", r.snapshotPath, "err", err)
+			}
+		}
+	}
+}
+
+// Writes the snapshot file. The set is encoded into memory under the read
+// lock, so writers are only held up for the encoding, not the disk write.
+func (r *Ranker) saveSnapshot() error {
+	var buf bytes.Buffer
+	r.mu.RLock()
+	err := writeImage(&buf, r.zset)
+	r.mu.RUnlock()
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(r.snapshotPath, func(w io.Writer) error {
+		_, err := w.Write(buf.Bytes())
+		return err
+	})
+}
+
+// Stops the snapshot loop, if running.
+func (r *Ranker) stopBackground() {
+	if r.stop != nil {
+		close(r.stop)
+		r.background.Wait()
+		r.stop = nil
+	}
+}
+
+// discardStore is the Store of a Ranker without persistence: writes are
+// dropped and it always reads as empty.
+type discardStore struct{}
+
+func (discardStore) Get(key []byte) ([]byte, error) { return nil, ErrKeyNotExist }
+func (discardStore) Set(key, value []byte) error    { return nil }
+func (discardStore) Delete(key []byte) error        { return nil }
+func (discardStore) NewBatch() Batch                { return discardBatch{} }
+func (discardStore) Close() error                   { return nil }
+
+func (discardStore) Iterate(lower, upper []byte, fn func(key, value []byte) error) error {
+	return nil
+}
+
+// discardBatch drops its writes.
+type discardBatch struct{}
+
+func (discardBatch) Set(key, value []byte) error { return nil }
+func (discardBatch) Delete(key []byte) error     { return nil }
+func (discardBatch) Commit() error               { return nil }
+func (discardBatch) Close() error                { return nil }
@@ -0,0 +1,171 @@
+package ranker
+
+import (
+	"bytes"
+	"slices"
+	"sync"
+)
+
+// MemoryStore is a Store that keeps everything in a map and persists
+// nothing, meant for tests and boards that don't need to survive a restart.
+type MemoryStore struct {
+	mu     sync.RWMutex
+	data   map[string][]byte
+	closed bool
+}
+
+// Creates an empty in-memory store.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{data: make(map[string][]byte)}
+}
+
+func (s *MemoryStore) Get(key []byte) ([]byte, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.closed {
+		return nil, ErrStoreClosed
+	}
+	value, ok := s.data[string(key)]
+	if !ok {
+		return nil, ErrKeyNotExist
+	}
+	return bytes.Clone(value), nil
+}
+
+func (s *MemoryStore) Set(key, value []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return ErrStoreClosed
+	}
+	s.data[string(key)] = bytes.Clone(value)
+	return nil
+}
+
+func (s *MemoryStore) Delete(key []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return ErrStoreClosed
+	}
+	delete(s.data, string(key))
+	return nil
+}
+
+func (s *MemoryStore) NewBatch() Batch {
+	return &memoryBatch{apply: s.apply}
+}
+
+// Iterates over a sorted copy of the keys taken when the call starts.
+func (s *MemoryStore) Iterate(lower, upper []byte, fn func(key, value []byte) error) error {
+	s.mu.RLock()
+	if s.closed {
+		s.mu.RUnlock()
+		return ErrStoreClosed
+	}
+	type kv struct{ key, value []byte }
+	items := make([]kv, 0, len(s.data))
+	for k, v := range s.data {
+		key := []byte(k)
+		if lower != nil && bytes.Compare(key, lower) < 0 {
+			continue
+		}
+		if upper != nil && bytes.Compare(key, upper) >= 0 {
+			continue
+		}
+		items = append(items, kv{key, v})
+	}
+	s.mu.RUnlock()
+
+	slices.SortFunc(items, func(a, b kv) int {
+		return bytes.Compare(a.key, b.key)
+	})
+	for _, item := range items {
+		if err := fn(item.key, item.value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *MemoryStore) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closed = true
+	s.data = nil
+	return nil
+}
+
+func (s *MemoryStore) Truncate() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return ErrStoreClosed
+	}
+	s.data = make(map[string][]byte)
+	return nil
+}
+
+// Returns a set op for every key, sorted by key.
+func (s *MemoryStore) snapshot() []batchOp {
+	s.mu.RLock()
+	ops := make([]batchOp, 0, len(s.data))
+	for k, v := range s.data {
+		ops = append(ops, batchOp{key: []byte(k), value: v})
+	}
+	s.mu.RUnlock()
+
+	slices.SortFunc(ops, func(a, b batchOp) int {
+		return bytes.Compare(a.key, b.key)
+	})
+	return ops
+}
+
+// Applies a committed batch under a single lock. Values are copied, since
+// stores building on this one pass their callers' memory straight through.
+func (s *MemoryStore) apply(ops []batchOp) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return ErrStoreClosed
+	}
+	for _, op := range ops {
+		if op.delete {
+			delete(s.data, string(op.key))
+		} else {
+			s.data[string(op.key)] = bytes.Clone(op.value)
+		}
+	}
+	return nil
+}
+
+// batchOp is a buffered write of a batch.
+type batchOp struct {
+	key, value []byte
+	delete     bool
+}
+
+// memoryBatch buffers writes until Commit hands them to apply.
+type memoryBatch struct {
+	ops   []batchOp
+	apply func(ops []batchOp) error
+}
+
+func (b *memoryBatch) Set(key, value []byte) error {
+	b.ops = append(b.ops, batchOp{key: bytes.Clone(key), value: bytes.Clone(value)})
+	return nil
+}
+
+func (b *memoryBatch) Delete(key []byte) error {
+	b.ops = append(b.ops, batchOp{key: bytes.Clone(key), delete: true})
+	return nil
+}
+
+func (b *memoryBatch) Commit() error {
+	return b.apply(b.ops)
+}
+
+func (b *memoryBatch) Close() error {
+	b.ops = nil
+	return nil
+}
@@ -0,0 +1,103 @@
+package ranker
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRanker_WithoutPersistence(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "rank")
+	r := New(WithoutPersistence(), WithStorageDir(dir))
+	assert.NoError(t, r.Start())
+
+	assert.NoError(t, r.Update("a", 1))
+	assert.NoError(t, r.Update("b", 2))
+	score, err := r.IncrBy("a", 5)
+	assert.NoError(t, err)
+	assert.Equal(t, float64(6), score)
+	assert.NoError(t, r.Remove("b"))
+	assert.ErrorIs(t, r.Remove("b"), ErrKeyNotExist)
+
+	entry, err := r.Rank("a")
+	assert.NoError(t, err)
+	assert.Equal(t, float64(6), entry.Score)
+	assert.NoError(t, r.Verify())
+	r.Close()
+
+	// Nothing touches the disk.
+	_, err = os.Stat(dir)
+	assert.True(t, os.IsNotExist(err))
+
+	r = New(WithoutPersistence())
+	assert.NoError(t, r.Start())
+	defer r.Close()
+	assert.Equal(t, 0, r.Count())
+}
+
+func TestRanker_SnapshotFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "board.snap")
+	r := New(WithoutPersistence(), WithSnapshotFile(path, 10*time.Millisecond))
+	assert.NoError(t, r.Start())
+	assert.NoError(t, r.Update("a", 1))
+	assert.NoError(t, r.Update("b", 2))
+
+	// The loop writes the file without waiting for Close.
+	assert.Eventually(t, func() bool {
+		z, err := readSnapshotFile(path)
+		return err == nil && z != nil && z.ZCard() == 2
+	}, time.Second, 5*time.Millisecond)
+
+	assert.NoError(t, r.Update("c", 3))
+	r.Close()
+
+	r = New(WithoutPersistence(), WithSnapshotFile(path, 0))
+	assert.NoError(t, r.Start())
+	defer r.Close()
+	entries, err := r.Range(0, -1)
+	assert.NoError(t, err)
+	assert.Equal(t, []*Entry{
+		{Rank: 0, Score: 3, Key: "c"},
+		{Rank: 1, Score: 2, Key: "b"},
+		{Rank: 2, Score: 1, Key: "a"},
+	}, entries)
+
+	assert.NoError(t, os.WriteFile(path, []byte("garbage"), 0644))
+	r2 := New(WithoutPersistence(), WithSnapshotFile(path, 0))
+	assert.ErrorIs(t, r2.Start(), errImageCorrupt)
+}
+
+func TestRanker_CheckWithoutPersistence(t *testing.T) {
+	r := New(WithoutPersistence())
+	assert.NoError(t, r.Start())
+	defer r.Close()
+	for _, key := range []string{"a", "b", "c"} {
+		assert.NoError(t, r.Update(key, 1))
+	}
+
+	// Break a span so the structure check fails.
+	r.zset.zset.zsl.head.level[0].span = 7
+	report, err := r.Check(true)
+	assert.NoError(t, err)
+	assert.NotEmpty(t, report.Structure)
+	assert.True(t, report.Repaired)
+	assert.NoError(t, r.Verify())
+	assert.Equal(t, 3, r.Count())
+}
+
+func TestRanker_SnapshotFileCorrupt(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "board.snap")
+	assert.NoError(t, os.WriteFile(path, []byte("garbage"), 0644))
+
+	r := New(WithoutPersistence(), WithSnapshotFile(path, 0))
+	assert.ErrorIs(t, r.Start(), errImageCorrupt)
+	r.Close()
+
+	// The unreadable file is left for inspection, not replaced by an empty board.
+	data, err := os.ReadFile(path)
+	assert.NoError(t, err)
+	assert.Equal(t, "garbage", string(data))
+}
@@ -0,0 +1,126 @@
+package ranker
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Configures Prometheus metrics for the Ranker, registered with reg on
+// Start and unregistered on Close. Every metric carries the Ranker ID as
+// the ranker label, so several Rankers can share a registry.
+func WithMetrics(reg prometheus.Registerer) Option {
+	return func(r *Ranker) {
+		r.metricsReg = reg
+	}
+}
+
+// metrics counts and times operations, and reports the size of the board
+// and its store when scraped.
+type metrics struct {
+	r        *Ranker
+	ops      *prometheus.CounterVec
+	duration *prometheus.HistogramVec
+
+	players   *prometheus.Desc
+	level     *prometheus.Desc
+	load      *prometheus.Desc
+	diskUsage *prometheus.Desc
+
+	pebbleCompactions *prometheus.Desc
+	pebbleFlushes     *prometheus.Desc
+	pebbleMemtable    *prometheus.Desc
+	pebbleReadAmp     *prometheus.Desc
+	pebbleWALWritten  *prometheus.Desc
+}
+
+func newMetrics(r *Ranker) *metrics {
+	labels := prometheus.Labels{"ranker": r.ID}
+	desc := func(name, help string) *prometheus.Desc {
+		return prometheus.NewDesc("ranker_"+name, help, nil, labels)
+	}
+	return &metrics{
+		r: r,
+		ops: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name:        "ranker_operations_total",
+			Help:        "Ranker operations by name and result.",
+			ConstLabels: labels,
+		}, []string{"op", "result"}),
+		duration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:        "ranker_operation_duration_seconds",
+			Help:        "Latency of Ranker operations, including waiting for the lock.",
+			ConstLabels: labels,
+			Buckets:     prometheus.ExponentialBuckets(1e-6, 4, 12),
+		}, []string{"op"}),
+
+		players:   desc("players", "Players on the leaderboard."),
+		level:     desc("skiplist_level", "Current level of the skiplist."),
+		load:      desc("load_duration_seconds", "Time Start took to load the leaderboard."),
+		diskUsage: desc("disk_usage_bytes", "Bytes used by the store on disk."),
+
+		pebbleCompactions: desc("pebble_compactions_total", "Compactions run by Pebble."),
+		pebbleFlushes:     desc("pebble_flushes_total", "Memtable flushes run by Pebble."),
+		pebbleMemtable:    desc("pebble_memtable_bytes", "Bytes allocated by Pebble memtables."),
+		pebbleReadAmp:     desc("pebble_read_amplification", "Pebble read amplification."),
+		pebbleWALWritten:  desc("pebble_wal_written_bytes_total", "Bytes written to the Pebble WAL."),
+	}
+}
+
+// Records an operation that took elapsed and returned err.
+// Safe to call on nil metrics, which records nothing.
+func (m *metrics) observe(op string, elapsed time.Duration, err error) {
+	if m == nil {
+		return
+	}
+	m.duration.WithLabelValues(op).Observe(elapsed.Seconds())
+	result := "ok"
+	if err != nil {
+		result = "error"
+	}
+	m.ops.WithLabelValues(op, result).Inc()
+}
+
+func (m *metrics) Describe(ch chan<- *prometheus.Desc) {
+	m.ops.Describe(ch)
+	m.duration.Describe(ch)
+	ch <- m.players
+	ch <- m.level
+	ch <- m.load
+	ch <- m.diskUsage
+	ch <- m.pebbleCompactions
+	ch <- m.pebbleFlushes
+	ch <- m.pebbleMemtable
+	ch <- m.pebbleReadAmp
+	ch <- m.pebbleWALWritten
+}
+
+func (m *metrics) Collect(ch chan<- prometheus.Metric) {
+	m.ops.Collect(ch)
+	m.duration.Collect(ch)
+
+	stats := m.r.stats()
+	m.r.mu.RLock()
+	load := m.r.loadDuration
+	store := m.r.store
+	m.r.mu.RUnlock()
+
+	gauge := func(desc *prometheus.Desc, value float64) {
+		ch <- prometheus.MustNewConstMetric(desc, prometheus.GaugeValue, value)
+	}
+	counter := func(desc *prometheus.Desc, value float64) {
+		ch <- prometheus.MustNewConstMetric(desc, prometheus.CounterValue, value)
+	}
+	gauge(m.players, float64(stats.Count))
+	gauge(m.level, float64(stats.Level))
+	gauge(m.load, load.Seconds())
+	gauge(m.diskUsage, float64(stats.DiskUsage))
+
+	if ps, ok := store.(*PebbleStore); ok {
+		pm := ps.DB().Metrics()
+		counter(m.pebbleCompactions, float64(pm.Compact.Count))
+		counter(m.pebbleFlushes, float64(pm.Flush.Count))
+		gauge(m.pebbleMemtable, float64(pm.MemTable.Size))
+		gauge(m.pebbleReadAmp, float64(pm.ReadAmp()))
+		counter(m.pebbleWALWritten, float64(pm.WAL.BytesWritten))
+	}
+}
@@ -0,0 +1,78 @@
+package ranker
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRanker_WithMetrics(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	r := New(WithID("board"), WithStorageDir(filepath.Join(t.TempDir(), "rank")), WithMetrics(reg))
+	assert.NoError(t, r.Start())
+
+	assert.NoError(t, r.Update("a", 1))
+	assert.NoError(t, r.Update("b", 2))
+	_, err := r.Rank("a")
+	assert.NoError(t, err)
+	_, err = r.Rank("missing")
+	assert.ErrorIs(t, err, ErrKeyNotExist)
+	_, err = r.Range(0, -1)
+	assert.NoError(t, err)
+
+	ops := r.metrics.ops
+	assert.Equal(t, float64(2), testutil.ToFloat64(ops.WithLabelValues(opUpdate, "ok")))
+	assert.Equal(t, float64(1), testutil.ToFloat64(ops.WithLabelValues(opRank, "ok")))
+	assert.Equal(t, float64(1), testutil.ToFloat64(ops.WithLabelValues(opRank, "error")))
+	assert.Equal(t, float64(1), testutil.ToFloat64(ops.WithLabelValues(opRange, "ok")))
+
+	families, err := reg.Gather()
+	assert.NoError(t, err)
+	values := make(map[string]float64)
+	for _, family := range families {
+		for _, m := range family.GetMetric() {
+			labels := make(map[string]string)
+			for _, label := range m.GetLabel() {
+				labels[label.GetName()] = label.GetValue()
+			}
+			assert.Equal(t, "board", labels["ranker"])
+			if m.GetGauge() != nil {
+				values[family.GetName()] = m.GetGauge().GetValue()
+			}
+		}
+	}
+	assert.Equal(t, float64(2), values["ranker_players"])
+	assert.Contains(t, values, "ranker_skiplist_level")
+	assert.Contains(t, values, "ranker_pebble_read_amplification")
+
+	// A second Ranker with the same ID can't share the registry.
+	assert.Error(t, New(WithID("board"), WithStorageDir(filepath.Join(t.TempDir(), "other")), WithMetrics(reg)).Start())
+
+	r.Close()
+	families, err = reg.Gather()
+	assert.NoError(t, err)
+	assert.Empty(t, families)
+}
+
+func TestRanker_WithMetricsStartFailure(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	dir := filepath.Join(t.TempDir(), "rank")
+	assert.NoError(t, os.WriteFile(dir, nil, 0644))
+	r := New(WithID("board"), WithStorageDir(dir), WithMetrics(reg))
+	assert.Error(t, r.Start())
+	families, err := reg.Gather()
+	assert.NoError(t, err)
+	assert.Empty(t, families)
+
+	// Once the store can be opened, a retry registers the metrics again.
+	assert.NoError(t, os.Remove(dir))
+	assert.NoError(t, r.Start())
+	families, err = reg.Gather()
+	assert.NoError(t, err)
+	assert.NotEmpty(t, families)
+	r.Close()
+}
@@ -0,0 +1,113 @@
+package ranker
+
+import (
+	"math"
+	"sort"
+)
+
+// RankEventType describes which side of a threshold crossing an event reports.
+type RankEventType int
+
+const (
+	Overtook  RankEventType = iota // Member entered the top Threshold and pushed Other out
+	Overtaken                      // Member was pushed out of the top Threshold by Other
+)
+
+// String returns the event type name.
+func (t RankEventType) String() string {
+	switch t {
+	case Overtook:
+		return "overtook"
+	case Overtaken:
+		return "overtaken"
+	}
+	return "unknown"
+}
+
+// RankEvent reports a member crossing one of the configured rank thresholds.
+type RankEvent struct {
+	Type      RankEventType // Whether Member moved in or out of the top Threshold
+	Member    string        // Player the event is about
+	Other     string        // Player on the other side of the crossing
+	Threshold int           // The "top N" boundary that was crossed
+	Rank      int           // Member's rank after the update
+}
+
+// Notifier receives the threshold crossings caused by a single update.
+// It runs while the Ranker is locked and must not call back into it.
+type Notifier func(events []RankEvent)
+
+// Configures the "top N" boundaries that trigger rank events, e.g. 10 and 100.
+func WithThresholds(thresholds ...int) Option {
+	return func(r *Ranker) {
+		ts := make([]int, 0, len(thresholds))
+		for _, t := range thresholds {
+			if t > 0 {
+				ts = append(ts, t)
+			}
+		}
+		sort.Ints(ts)
+		r.thresholds = ts
+	}
+}
+
+// Configures the callback invoked with the rank events of every update.
+func WithNotifier(notifier Notifier) Option {
+	return func(r *Ranker) {
+		r.notifier = notifier
+	}
+}
+
+// Adds the score to the in-memory set and emits rank events when enabled.
+func (r *Ranker) zadd(playerID string, score float64) error {
+	if r.notifier == nil || len(r.thresholds) == 0 {
+		_, err := r.zset.ZAdd(score, playerID)
+		return err
+	}
+
+	oldRank, newRank, err := r.zset.ZAddWithRevRank(score, playerID)
+	if err != nil {
+		return err
+	}
+	if oldRank < 0 {
+		// A new member comes from below the whole board.
+		oldRank = math.MaxInt64
+	}
+	if events := r.crossings(playerID, oldRank, newRank); len(events) > 0 {
+		r.notifier(events)
+	}
+	return nil
+}
+
+// Collects the events for a member moving from oldRank to newRank.
+// Only the thresholds between the two ranks are inspected and each one
+// costs a single rank lookup, so the work is O(log N + k).
+func (r *Ranker) crossings(playerID string, oldRank, newRank int64) []RankEvent {
+	var events []RankEvent
+	for _, t := range r.thresholds {
+		threshold := int64(t)
+		switch {
+		case newRank < threshold && oldRank >= threshold:
+			// Moved up into the top t: whoever sat at t-1 is now at t.
+			other, err := r.zset.ZRevMemberByRank(threshold)
+			if err != nil {
+				continue
+			}
+			events = append(events,
+				RankEvent{Type: Overtook, Member: playerID, Other: other, Threshold: t, Rank: int(newRank)},
+				RankEvent{Type: Overtaken, Member: other, Other: playerID, Threshold: t, Rank: t},
+			)
+		case oldRank < threshold && newRank >= threshold:
+			// Dropped out of the top t: whoever sat at t is now at t-1.
+			other, err := r.zset.ZRevMemberByRank(threshold - 1)
+			if err != nil {
+				continue
+			}
+			events = append(events,
+				RankEvent{Type: Overtaken, Member: playerID, Other: other, Threshold: t, Rank: int(newRank)},
+				RankEvent{Type: Overtook, Member: other, Other: playerID, Threshold: t, Rank: t - 1},
+			)
+		}
+	}
+	return events
+}
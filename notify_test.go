@@ -0,0 +1,36 @@
+package ranker
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRanker_Notifier(t *testing.T) {
+	var events []RankEvent
+	r := New(
+		WithStorageDir(t.TempDir()),
+		WithThresholds(2),
+		WithNotifier(func(es []RankEvent) { events = append(events, es...) }),
+	)
+	assert.NoError(t, r.Start())
+	defer r.Close()
+
+	assert.NoError(t, r.Update("a", 3))
+	assert.NoError(t, r.Update("b", 2))
+	assert.NoError(t, r.Update("c", 1))
+	assert.Empty(t, events)
+
+	assert.NoError(t, r.Update("c", 5))
+	assert.Equal(t, []RankEvent{
+		{Type: Overtook, Member: "c", Other: "b", Threshold: 2, Rank: 0},
+		{Type: Overtaken, Member: "b", Other: "c", Threshold: 2, Rank: 2},
+	}, events)
+
+	events = nil
+	assert.NoError(t, r.Update("a", 0))
+	assert.Equal(t, []RankEvent{
+		{Type: Overtaken, Member: "a", Other: "b", Threshold: 2, Rank: 2},
+		{Type: Overtook, Member: "b", Other: "a", Threshold: 2, Rank: 1},
+	}, events)
+}
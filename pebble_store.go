@@ -0,0 +1,201 @@
+package ranker
+
+import (
+	"bytes"
+	"slices"
+	"sync"
+
+	"github.com/cockroachdb/pebble"
+)
+
+// PebbleStore is the default Store, backed by a Pebble database.
+type PebbleStore struct {
+	db  *pebble.DB
+	dir string
+
+	mu     sync.RWMutex // Keeps Close from running during a checkpoint or scan
+	closed bool
+}
+
+// Opens or creates a Pebble database in dir.
+func OpenPebbleStore(dir string, opts *pebble.Options) (*PebbleStore, error) {
+	if opts == nil {
+		opts = &pebble.Options{}
+	}
+	db, err := pebble.Open(dir, opts)
+	if err != nil {
+		return nil, err
+	}
+	return &PebbleStore{db: db, dir: dir}, nil
+}
+
+// Returns the directory of the database.
+func (s *PebbleStore) Dir() string {
+	return s.dir
+}
+
+// Returns the underlying Pebble database.
+func (s *PebbleStore) DB() *pebble.DB {
+	return s.db
+}
+
+func (s *PebbleStore) Get(key []byte) ([]byte, error) {
+	value, closer, err := s.db.Get(key)
+	if err == pebble.ErrNotFound {
+		return nil, ErrKeyNotExist
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer closer.Close()
+	return bytes.Clone(value), nil
+}
+
+func (s *PebbleStore) Set(key, value []byte) error {
+	return s.db.Set(key, value, pebble.NoSync)
+}
+
+func (s *PebbleStore) Delete(key []byte) error {
+	return s.db.Delete(key, pebble.NoSync)
+}
+
+func (s *PebbleStore) NewBatch() Batch {
+	return &pebbleBatch{b: s.db.NewBatch()}
+}
+
+// Iterates over a consistent view of the keys, a concurrent Close waits
+// for it.
+func (s *PebbleStore) Iterate(lower, upper []byte, fn func(key, value []byte) error) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.closed {
+		return ErrStoreClosed
+	}
+	iter, err := s.db.NewIter(&pebble.IterOptions{LowerBound: lower, UpperBound: upper})
+	if err != nil {
+		return err
+	}
+	for iter.First(); iter.Valid(); iter.Next() {
+		if err := fn(iter.Key(), iter.Value()); err != nil {
+			iter.Close()
+			return err
+		}
+	}
+	if err := iter.Error(); err != nil {
+		iter.Close()
+		return err
+	}
+	return iter.Close()
+}
+
+func (s *PebbleStore) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return ErrStoreClosed
+	}
+	s.closed = true
+	return s.db.Close()
+}
+
+// Removes every key with a single range tombstone.
+func (s *PebbleStore) Truncate() error {
+	iter, err := s.db.NewIter(&pebble.IterOptions{})
+	if err != nil {
+		return err
+	}
+	var last []byte
+	if iter.Last() {
+		last = bytes.Clone(iter.Key())
+	}
+	if err := iter.Close(); err != nil {
+		return err
+	}
+	if last == nil {
+		return nil
+	}
+	// The range end is exclusive, so extend the largest key by one byte.
+	return s.db.DeleteRange([]byte{}, append(last, 0), pebble.NoSync)
+}
+
+// Writes a Pebble checkpoint: sstables are hard-linked and the WAL is
+// copied after being flushed, so this is fast and consistent. Writes go on
+// meanwhile, a concurrent Close waits for it.
+func (s *PebbleStore) Checkpoint(dir string) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.closed {
+		return ErrStoreClosed
+	}
+	return s.db.Checkpoint(dir, pebble.WithFlushedWAL())
+}
+
+// Returns the bytes used by the database on disk.
+func (s *PebbleStore) DiskUsage() uint64 {
+	return s.db.Metrics().DiskSpaceUsage()
+}
+
+// Splits the keyspace into at most n ranges of similar on-disk size, using
+// the smallest keys of the sstables as split points. Data that only lives in
+// the memtable yet is small enough to be read as a single range.
+func (s *PebbleStore) Split(n int) ([]KeyRange, error) {
+	if n <= 1 {
+		return []KeyRange{{}}, nil
+	}
+	levels, err := s.db.SSTables()
+	if err != nil {
+		return nil, err
+	}
+
+	type boundary struct {
+		key  []byte
+		size uint64
+	}
+	var bounds []boundary
+	var total uint64
+	for _, tables := range levels {
+		for _, t := range tables {
+			bounds = append(bounds, boundary{key: t.Smallest.UserKey, size: t.Size})
+			total += t.Size
+		}
+	}
+	slices.SortFunc(bounds, func(a, b boundary) int {
+		return bytes.Compare(a.key, b.key)
+	})
+
+	ranges := make([]KeyRange, 0, n)
+	var lower []byte
+	var acc uint64
+	for _, b := range bounds {
+		// Start a new range once the current one holds its share of the data.
+		if acc >= total*uint64(len(ranges)+1)/uint64(n) && len(ranges) < n-1 &&
+			(lower == nil || bytes.Compare(b.key, lower) > 0) {
+			upper := bytes.Clone(b.key)
+			ranges = append(ranges, KeyRange{Lower: lower, Upper: upper})
+			lower = upper
+		}
+		acc += b.size
+	}
+	return append(ranges, KeyRange{Lower: lower}), nil
+}
+
+// pebbleBatch adapts a Pebble batch to the Batch interface.
+type pebbleBatch struct {
+	b *pebble.Batch
+}
+
+func (b *pebbleBatch) Set(key, value []byte) error {
+	return b.b.Set(key, value, nil)
+}
+
+func (b *pebbleBatch) Delete(key []byte) error {
+	return b.b.Delete(key, nil)
+}
+
+func (b *pebbleBatch) Commit() error {
+	return b.b.Commit(pebble.NoSync)
+}
+
+func (b *pebbleBatch) Close() error {
+	return b.b.Close()
+}
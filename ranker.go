@@ -1,19 +1,23 @@
 package ranker
 
 import (
+	"context"
 	"encoding/binary"
-	"fmt"
+	"log/slog"
 	"math"
 	"os"
+	"runtime"
+	"sync"
 	"time"
 	"unsafe"
 
-	"github.com/cockroachdb/pebble"
 	"github.com/google/uuid"
+	"github.com/prometheus/client_golang/prometheus"
 )
 
 const (
-	defaultStorageDir = ".rank" // Default storage directory
+	defaultStorageDir   = ".rank" // Default storage directory
+	cancelCheckInterval = 1024    // Records between checks of a context during long operations
 )
 
 // Converts float64 to a byte slice (little-endian).
@@ -40,22 +44,70 @@ func unsafeBytesToString(b []byte) string {
 	return *(*string)(unsafe.Pointer(&b))
 }
 
+// Returns the error of ctx on every cancelCheckInterval-th record n.
+func checkCanceled(ctx context.Context, n int) error {
+	if n%cancelCheckInterval != 0 {
+		return nil
+	}
+	return ctx.Err()
+}
+
 // Option defines configuration options for the Ranker.
 type Option func(*Ranker)
 
 // Ranker manages leaderboard operations.
 type Ranker struct {
-	ID         string // Ranker instance identifier
-	StorageDir string // Directory for persistent storage
+	ID         string       // Ranker instance identifier
+	StorageDir string       // Directory for persistent storage
+	mu         sync.RWMutex // Keeps zset and store in step with each other
 	zset       *ZSet
-	db         *pebble.DB
+	store      Store
+	openStore  func() (Store, error) // Opens the store on Start, nil for Pebble
+	thresholds []int                 // Rank boundaries that trigger events
+	notifier   Notifier              // Receives rank events, nil disables them
+
+	loadConcurrency int // Goroutines reading the store during Start
+
+	async       bool               // Load in the background instead of blocking Start
+	ready       chan struct{}      // Closed once a Start attempt has loaded the set or failed
+	loading     sync.WaitGroup     // Tracks the background load
+	cancelLoad  context.CancelFunc // Stops the background load, called by Close
+	warming     bool               // Set while the background load runs and after a failed Start
+	loadErr     error              // Error that stopped the last Start attempt
+	loaded      bool               // Set once the board was loaded, Close only writes the image then
+	reopenStore bool               // A failed Start closed the store it opened, a retry opens it again
+	pending     []pendingOp        // Writes accepted while warming
+
+	ephemeral        bool           // The ZSet is the only copy, see WithoutPersistence
+	snapshotPath     string         // File the in-memory set is snapshotted to
+	snapshotInterval time.Duration  // Time between snapshots, 0 only on Close
+	stop             chan struct{}  // Closed to stop background work
+	background       sync.WaitGroup // Tracks the snapshot loop
+
+	changes     *changeLog            // Recent changes for followers, nil until ServeReplication
+	replBacklog int                   // Changes kept in the log
+	replMu      sync.Mutex            // Guards replicas
+	replicas    map[*replica]struct{} // Connected followers
+
+	approx  *approxRanks // Ranks players outside the head approximately, nil for exact ranks
+	maxSize int          // Players kept by a capped board, 0 for no cap
+
+	metrics      *metrics              // Operation metrics, nil disables them
+	metricsReg   prometheus.Registerer // Registry the metrics are added to on Start
+	loadDuration time.Duration         // Time Start took to load the data
+
+	logger        *slog.Logger  // Receives structured events, discards them by default
+	slowThreshold time.Duration // Operations taking longer are logged, 0 disables
+	slowlog       slowlog       // Recent slow operations
+	tracer        Tracer        // Receives a span per operation, nil disables them
 }
 
 // Entry represents a player's rank, score, and identifier.
 type Entry struct {
-	Rank  int     // Player's rank
-	Score float64 // Player's score
-	Key   string  // Player's unique identifier
+	Rank  int     `json:"rank"`            // Player's rank
+	Score float64 `json:"score"`           // Player's score
+	Key   string  `json:"key"`             // Player's unique identifier
+	Error int     `json:"error,omitempty"` // Rank may be off by up to this many positions
 }
 
 // Configures a custom ID for the Ranker instance.
@@ -78,6 +130,13 @@ func New(options ...Option) *Ranker {
 		ID:         uuid.NewString(),
 		StorageDir: defaultStorageDir,
 		zset:       NewZSet(),
+		ready:      make(chan struct{}),
+
+		loadConcurrency: runtime.GOMAXPROCS(0),
+		replBacklog:     defaultReplBacklog,
+		logger:          slog.New(discardHandler{}),
+		slowThreshold:   defaultSlowThreshold,
+		slowlog:         slowlog{size: defaultSlowlogSize},
 	}
 	for _, opt := range options {
 		opt(ranker)
@@ -86,54 +145,490 @@ func New(options ...Option) *Ranker {
 }
 
 // Initializes the Ranker, including loading existing data.
+// Without WithStore a Pebble store is opened in StorageDir.
+// With WithAsyncStart the data is loaded in the background, see Ready.
+// A failed Start closes ready and keeps its error for LoadError and rank
+// queries, closing a store it opened itself; Start can then be retried.
 func (r *Ranker) Start() error {
-	var err error
-	exist := r.dataExists(r.StorageDir)
+	return r.StartContext(context.Background())
+}
 
-	r.db, err = pebble.Open(r.StorageDir, &pebble.Options{})
-	if err != nil {
-		return err
+// Like Start, stopping the load with the error of ctx once it is done,
+// including a background load.
+func (r *Ranker) StartContext(ctx context.Context) error {
+	r.mu.Lock()
+	if r.loadErr != nil {
+		// Retrying after a failed attempt, which closed the old channel.
+		r.ready = make(chan struct{})
+		r.loadErr = nil
+		r.warming = false
+		if r.reopenStore {
+			r.store = nil
+			r.reopenStore = false
+		}
 	}
+	r.mu.Unlock()
 
-	if exist {
+	opened := r.store == nil
+	if r.metricsReg != nil {
+		m := newMetrics(r)
+		if err := r.metricsReg.Register(m); err != nil {
+			return r.startFailed(err, false)
+		}
+		r.metrics = m
+	}
+	if err := r.start(ctx); err != nil {
+		return r.startFailed(err, opened)
+	}
+	return nil
+}
+
+// Opens the store and loads the board for StartContext.
+func (r *Ranker) start(ctx context.Context) error {
+	if r.store == nil && r.openStore != nil {
+		store, err := r.openStore()
+		if err != nil {
+			return err
+		}
+		r.store = store
+	}
+	if r.approx != nil && (r.ephemeral || r.maxSize > 0) {
+		return ErrInvalidParams
+	}
+	if r.ephemeral {
+		err := ctx.Err()
+		if err == nil {
+			err = r.startEphemeral()
+		}
+		if err == nil {
+			r.mu.Lock()
+			r.loaded = true
+			err = r.enforceMaxSize()
+			r.mu.Unlock()
+		}
+		if err != nil {
+			return err
+		}
+		close(r.ready)
+		return nil
+	}
+	if r.store == nil {
+		exist := r.dataExists(r.StorageDir)
+		store, err := OpenPebbleStore(r.StorageDir, r.pebbleOptions())
+		if err != nil {
+			return err
+		}
+		r.store = store
+		if !exist {
+			r.loaded = true
+			r.logger.Info("ranker started", "id", r.ID, "dir", r.StorageDir, "players", 0)
+			close(r.ready)
+			return nil
+		}
+	}
+
+	if r.approx != nil {
 		startTime := time.Now()
-		if err := r.loadData(); err != nil {
+		r.mu.Lock()
+		err := r.loadApprox(ctx)
+		r.loadDuration = time.Since(startTime)
+		r.mu.Unlock()
+		if err != nil {
 			return err
 		}
-		elapsedTime := time.Since(startTime)
-		fmt.Printf("loaded in %v\n", elapsedTime)
+		r.logLoaded()
+		close(r.ready)
+		return nil
+	}
+
+	r.logger.Info("loading", "id", r.ID, "dir", r.StorageDir, "async", r.async)
+	if r.async {
+		r.warming = true
+		ctx, r.cancelLoad = context.WithCancel(ctx)
+		r.loading.Add(1)
+		go r.warmUp(ctx)
+		return nil
 	}
+
+	startTime := time.Now()
+	z, err := r.load(ctx)
+	if err != nil {
+		return err
+	}
+	r.zset = z
+	r.loadDuration = time.Since(startTime)
+	r.mu.Lock()
+	r.loaded = true
+	err = r.enforceMaxSize()
+	r.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	r.logLoaded()
+	close(r.ready)
 	return nil
 }
 
-// Releases resources associated with the Ranker.
+// Ends a failed Start attempt like a failed background load ends: err is
+// kept for LoadError and rank queries, and ready is closed. A store the
+// attempt opened is closed and replaced by a closed one, whose operations
+// return ErrStoreClosed; a store passed with WithStore stays open for the
+// retry. The registry is left as it was. Returns err.
+func (r *Ranker) startFailed(err error, opened bool) error {
+	r.logger.Error("start failed", "id", r.ID, "err", err)
+	if r.metrics != nil {
+		r.metricsReg.Unregister(r.metrics)
+		r.metrics = nil
+	}
+	r.mu.Lock()
+	r.loadErr = err
+	r.warming = true
+	r.loaded = false
+	r.pending = nil
+	if opened && r.store != nil {
+		if closeErr := r.store.Close(); closeErr != nil {
+			r.logger.Error("failed to close store", "id", r.ID, "err", closeErr)
+		}
+		closed := NewMemoryStore()
+		closed.Close()
+		r.store = closed
+		r.reopenStore = true
+	}
+	r.mu.Unlock()
+	close(r.ready)
+	return err
+}
+
+// Logs the end of a successful load.
+func (r *Ranker) logLoaded() {
+	r.logger.Info("ranker started", "id", r.ID, "dir", r.StorageDir,
+		"players", r.stats().Count, "duration", r.loadDuration)
+}
+
+// Releases resources associated with the Ranker, stopping a background
+// load that is still running.
 func (r *Ranker) Close() {
-	if r.db != nil {
-		r.db.Close()
+	if r.cancelLoad != nil {
+		r.cancelLoad()
+	}
+	r.loading.Wait()
+	if r.approx != nil {
+		r.approx.stopRefill()
+	}
+	if r.metrics != nil {
+		r.metricsReg.Unregister(r.metrics)
+	}
+	r.stopBackground()
+	if r.ephemeral && r.snapshotPath != "" && r.store != nil && r.loaded {
+		if err := r.saveSnapshot(); err != nil {
+			r.logger.Error("failed to save snapshot", "id", r.ID, "path", r.snapshotPath, "err", err)
+		}
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.store != nil {
+		if r.loaded {
+			if err := r.writeImage(); err != nil {
+				r.logger.Warn("failed to write image", "id", r.ID, "err", err)
+			}
+		}
+		if err := r.store.Close(); err != nil {
+			r.logger.Error("failed to close store", "id", r.ID, "err", err)
+		}
+		r.store = nil
 	}
 }
 
 // Updates or adds a player's score in the leaderboard.
 func (r *Ranker) Update(playerID string, score float64) error {
-	if err := r.db.Set(unsafeStringToBytes(playerID), float64ToBytes(score), pebble.NoSync); err != nil {
+	return r.UpdateContext(context.Background(), playerID, score)
+}
+
+// Like Update, tracing the operation under ctx and failing with its error
+// when it is done before the update starts.
+func (r *Ranker) UpdateContext(ctx context.Context, playerID string, score float64) (err error) {
+	op := r.begin(ctx, opUpdate, slog.String("player", playerID), slog.Float64("score", score))
+	defer op.end(&err)
+	if err := ctx.Err(); err != nil {
 		return err
 	}
-	_, err := r.zset.ZAdd(score, playerID)
-	return err
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err := r.set(playerID, score); err != nil {
+		return err
+	}
+	r.logChange(ChangeSet, playerID, score)
+	return r.enforceMaxSize()
+}
+
+// Writes a score to the store and the in-memory set, the caller holds the lock.
+func (r *Ranker) set(playerID string, score float64) error {
+	if r.approx != nil {
+		return r.approxSet(playerID, score)
+	}
+	if err := r.store.Set(unsafeStringToBytes(playerID), float64ToBytes(score)); err != nil {
+		return err
+	}
+	return r.applySet(playerID, score)
+}
+
+// Applies a stored score to the in-memory set, buffering it while warming.
+func (r *Ranker) applySet(playerID string, score float64) error {
+	if r.warming {
+		r.addPending(pendingOp{playerID: playerID, score: score})
+		return nil
+	}
+	return r.zadd(playerID, score)
 }
 
 // Retrieves the ranking details for a specific player.
 func (r *Ranker) Rank(playerID string) (*Entry, error) {
+	return r.RankContext(context.Background(), playerID)
+}
+
+// Like Rank, with ctx for tracing and cancellation.
+func (r *Ranker) RankContext(ctx context.Context, playerID string) (_ *Entry, err error) {
+	op := r.begin(ctx, opRank, slog.String("player", playerID))
+	defer op.end(&err)
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if err := r.checkReady(); err != nil {
+		return nil, err
+	}
 	result, err := r.zset.ZRevRankWithScore(playerID)
+	if err == ErrKeyNotExist && r.approx != nil {
+		return r.approxRank(playerID)
+	}
 	if err != nil {
 		return nil, err
 	}
 	return &Entry{Rank: int(result.Rank), Score: result.Score, Key: playerID}, nil
 }
 
-// Retrieves a range of ranking entries.
+// Adds increment to a player's score, treating a missing player as 0.
+func (r *Ranker) IncrBy(playerID string, increment float64) (float64, error) {
+	return r.IncrByContext(context.Background(), playerID, increment)
+}
+
+// Like IncrBy, with ctx for tracing and cancellation.
+func (r *Ranker) IncrByContext(ctx context.Context, playerID string, increment float64) (_ float64, err error) {
+	op := r.begin(ctx, opIncrBy, slog.String("player", playerID), slog.Float64("increment", increment))
+	defer op.end(&err)
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if inc, ok := r.store.(Incrementer); ok && r.approx == nil {
+		score, err := inc.Incr(unsafeStringToBytes(playerID), increment)
+		if err != nil {
+			return 0, err
+		}
+		r.logChange(ChangeIncr, playerID, increment)
+		if err := r.applySet(playerID, score); err != nil {
+			return 0, err
+		}
+		return score, r.enforceMaxSize()
+	}
+
+	score, err := r.score(playerID)
+	if err != nil && err != ErrKeyNotExist {
+		return 0, err
+	}
+	score += increment
+	if err := r.set(playerID, score); err != nil {
+		return 0, err
+	}
+	r.logChange(ChangeIncr, playerID, increment)
+	return score, r.enforceMaxSize()
+}
+
+// Removes a player from the leaderboard.
+func (r *Ranker) Remove(playerID string) error {
+	return r.RemoveContext(context.Background(), playerID)
+}
+
+// Like Remove, with ctx for tracing and cancellation.
+func (r *Ranker) RemoveContext(ctx context.Context, playerID string) (err error) {
+	op := r.begin(ctx, opRemove, slog.String("player", playerID))
+	defer op.end(&err)
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	score, err := r.score(playerID)
+	if err != nil {
+		return err
+	}
+	if err := r.store.Delete(unsafeStringToBytes(playerID)); err != nil {
+		return err
+	}
+	r.logChange(ChangeRemove, playerID, 0)
+	if r.approx != nil {
+		r.approxRemove(playerID, score)
+		r.approxRefill()
+		return nil
+	}
+	if r.warming {
+		r.addPending(pendingOp{playerID: playerID, remove: true})
+		return nil
+	}
+	return r.zset.ZRem(playerID)
+}
+
+// Returns the number of players on the leaderboard, 0 while still warming up.
+func (r *Ranker) Count() int {
+	return r.CountContext(context.Background())
+}
+
+// Like Count, tracing the operation under ctx.
+func (r *Ranker) CountContext(ctx context.Context) int {
+	op := r.begin(ctx, opCount)
+	defer op.end(nil)
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if r.approx != nil {
+		return r.zset.ZCard() + int(r.approx.hist.total)
+	}
+	return r.zset.ZCard()
+}
+
+// Returns the number of players with a score between min and max inclusive.
+func (r *Ranker) CountByScore(min, max float64) (int, error) {
+	return r.CountByScoreContext(context.Background(), min, max)
+}
+
+// Like CountByScore, with ctx for tracing and cancellation.
+func (r *Ranker) CountByScoreContext(ctx context.Context, min, max float64) (_ int, err error) {
+	op := r.begin(ctx, opCountByScore, slog.Float64("min", min), slog.Float64("max", max))
+	defer op.end(&err)
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if err := r.checkReady(); err != nil {
+		return 0, err
+	}
+	count := int(r.zset.ZCount(min, max))
+	if r.approx != nil {
+		count += r.approx.countByScore(min, max)
+	}
+	return count, nil
+}
+
+// Returns the number of players ranked ahead of a player with the given
+// score and ID, who doesn't need to exist: higher scores, and equal scores
+// with a greater ID, like the tie order of Rank.
+func (r *Ranker) CountAbove(score float64, playerID string) (int, error) {
+	return r.CountAboveContext(context.Background(), score, playerID)
+}
+
+// Like CountAbove, with ctx for tracing and cancellation.
+func (r *Ranker) CountAboveContext(ctx context.Context, score float64, playerID string) (_ int, err error) {
+	op := r.begin(ctx, opCountAbove, slog.Float64("score", score), slog.String("player", playerID))
+	defer op.end(&err)
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if err := r.checkReady(); err != nil {
+		return 0, err
+	}
+	count := int(r.zset.ZCountAbove(score, playerID))
+	if r.approx != nil && !r.approx.inHead(score) {
+		count += r.approx.countAbove(score)
+	}
+	return count, nil
+}
+
+// Retrieves a range of ranking entries, start and end are inclusive ranks.
 func (r *Ranker) Range(start, end int) ([]*Entry, error) {
-	return nil, nil
+	return r.RangeContext(context.Background(), start, end)
+}
+
+// Like Range, with ctx for tracing and cancellation, which is also checked
+// while collecting the entries.
+func (r *Ranker) RangeContext(ctx context.Context, start, end int) (_ []*Entry, err error) {
+	op := r.begin(ctx, opRange, slog.Int("start", start), slog.Int("end", end))
+	defer op.end(&err)
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if err := r.checkReady(); err != nil {
+		return nil, err
+	}
+
+	length := r.zset.ZCard()
+	if start < 0 {
+		start = max(start+length, 0)
+	}
+	if end < 0 {
+		end += length
+	}
+	end = min(end, length-1)
+	if start > end {
+		return []*Entry{}, nil
+	}
+
+	entries := make([]*Entry, 0, end-start+1)
+	x := r.zset.zset.zsl.getNodeByRank(uint64(length - start))
+	for rank := start; rank <= end; rank++ {
+		if err := checkCanceled(ctx, rank-start+1); err != nil {
+			return nil, err
+		}
+		entries = append(entries, &Entry{Rank: rank, Score: x.score, Key: x.member})
+		x = x.backward
+	}
+	return entries, nil
+}
+
+// Stats describes the size of a Ranker.
+type Stats struct {
+	ID         string // Ranker instance identifier
+	StorageDir string // Directory for persistent storage
+	Count      int    // Number of players on the leaderboard
+	Level      int    // Current skiplist level
+	DiskUsage  uint64 // Bytes used by the store on disk
+}
+
+// Returns size information about the leaderboard and its storage.
+func (r *Ranker) Stats() Stats {
+	return r.StatsContext(context.Background())
+}
+
+// Like Stats, tracing the operation under ctx.
+func (r *Ranker) StatsContext(ctx context.Context) Stats {
+	op := r.begin(ctx, opStats)
+	defer op.end(nil)
+	return r.stats()
+}
+
+// Collects the stats without tracing, for internal use such as metrics
+// scrapes.
+func (r *Ranker) stats() Stats {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	stats := Stats{
+		ID:         r.ID,
+		StorageDir: r.StorageDir,
+		Count:      r.zset.ZCard(),
+		Level:      r.zset.zset.zsl.level,
+	}
+	if r.approx != nil {
+		stats.Count += int(r.approx.hist.total)
+	}
+	if sizer, ok := r.store.(Sizer); ok {
+		stats.DiskUsage = sizer.DiskUsage()
+	}
+	return stats
 }
 
 // Checks if persistent data exists at the specified path.
@@ -142,20 +637,14 @@ func (r *Ranker) dataExists(path string) bool {
 	return err == nil || !os.IsNotExist(err)
 }
 
-// Loads leaderboard data from persistent storage into memory.
-func (r *Ranker) loadData() error {
-	iter, err := r.db.NewIter(&pebble.IterOptions{})
-	if err != nil {
-		return err
+// Builds the in-memory set from the image if one is usable, otherwise
+// by reading every stored record. A done ctx fails it before either.
+func (r *Ranker) load(ctx context.Context) (*ZSet, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
 	}
-	defer iter.Close()
-
-	for iter.First(); iter.Valid(); iter.Next() {
-		playerID := unsafeBytesToString(iter.Key())
-		score := bytesToFloat64(iter.Value())
-		if _, err := r.zset.ZAdd(score, playerID); err != nil {
-			return err
-		}
+	if z, ok := r.loadImage(); ok {
+		return z, nil
 	}
-	return iter.Error()
+	return r.loadData(ctx)
 }
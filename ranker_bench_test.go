@@ -0,0 +1,35 @@
+package ranker
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"testing"
+)
+
+// BenchmarkLoadData reads a million-entry store with different concurrency.
+func BenchmarkLoadData(b *testing.B) {
+	dir, err := os.MkdirTemp("", "ranker-bench")
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	makeStore(b, dir, 1000000)
+
+	for _, n := range []int{1, 2, 4, 8} {
+		b.Run(fmt.Sprintf("concurrency=%d", n), func(b *testing.B) {
+			r := New(WithStorageDir(dir), WithLoadConcurrency(n))
+			if err := r.Start(); err != nil {
+				b.Fatal(err)
+			}
+			defer r.store.Close()
+
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if _, err := r.loadData(context.Background()); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,425 @@
+package ranker
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"math"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	replMagic          = "RKREPL01" // Sent by followers to open a replication stream
+	replBatchSize      = 1024       // Changes sent per wake-up of a replica stream
+	defaultReplBacklog = 1 << 16    // Changes kept for followers that reconnect
+
+	replFullSync byte = 'F' // Primary to follower: id, seq and an image of the set
+	replChange   byte = 'O' // Primary to follower: a single change
+	replPing     byte = 'P' // Primary to follower: latest seq of the primary
+	replAck      byte = 'A' // Follower to primary: last applied seq
+)
+
+var (
+	errReplProtocol = errors.New("replication protocol error")
+)
+
+// Time between pings of an idle stream, and how often followers report their
+// progress. A stream silent for three intervals is considered dead.
+var replPingInterval = time.Second
+
+// ChangeOp is the kind of a replicated change.
+type ChangeOp byte
+
+const (
+	ChangeSet    ChangeOp = 'S' // Value is the new score
+	ChangeIncr   ChangeOp = 'I' // Value is the increment
+	ChangeRemove ChangeOp = 'D' // Value is unused
+)
+
+// Change is an entry of the replication log.
+type Change struct {
+	Seq   uint64
+	Op    ChangeOp
+	Key   string
+	Value float64
+}
+
+// changeLog keeps the most recent changes in a ring buffer. Appends happen
+// under the Ranker write lock and reads under the read lock.
+type changeLog struct {
+	id    string        // Identifies the history, changed when it is cut
+	ring  []Change      // Holds the changes [first, next)
+	first uint64        // Oldest retained seq
+	next  uint64        // Seq of the next change
+	wake  chan struct{} // Closed and replaced whenever the log changes
+}
+
+// Creates an empty log retaining up to size changes.
+func newChangeLog(size int) *changeLog {
+	return &changeLog{
+		id:    uuid.NewString(),
+		ring:  make([]Change, max(size, 1)),
+		first: 1,
+		next:  1,
+		wake:  make(chan struct{}),
+	}
+}
+
+// Records a change, dropping the oldest one when full.
+func (l *changeLog) append(op ChangeOp, key string, value float64) {
+	if l.next-l.first == uint64(len(l.ring)) {
+		l.first++
+	}
+	l.ring[l.next%uint64(len(l.ring))] = Change{Seq: l.next, Op: op, Key: key, Value: value}
+	l.next++
+	l.notify()
+}
+
+// Starts a new history, so every follower resyncs from a snapshot. Used
+// after bulk changes that are not recorded one by one.
+func (l *changeLog) reset() {
+	l.id = uuid.NewString()
+	l.first = l.next
+	l.notify()
+}
+
+func (l *changeLog) notify() {
+	close(l.wake)
+	l.wake = make(chan struct{})
+}
+
+// Returns up to n changes starting at seq, or false when seq is no longer
+// retained.
+func (l *changeLog) since(seq uint64, n int) ([]Change, bool) {
+	if seq < l.first || seq > l.next {
+		return nil, false
+	}
+	changes := make([]Change, min(l.next-seq, uint64(n)))
+	for i := range changes {
+		changes[i] = l.ring[(seq+uint64(i))%uint64(len(l.ring))]
+	}
+	return changes, true
+}
+
+// Configures how many changes the primary keeps for followers that fall
+// behind or reconnect; older followers resync from a snapshot.
+func WithReplicationBacklog(n int) Option {
+	return func(r *Ranker) {
+		r.replBacklog = max(n, 1)
+	}
+}
+
+// Records a change for followers, the caller holds the write lock.
+func (r *Ranker) logChange(op ChangeOp, playerID string, value float64) {
+	if r.changes != nil {
+		r.changes.append(op, playerID, value)
+	}
+}
+
+// Forces followers to resync, the caller holds the write lock.
+func (r *Ranker) resetChanges() {
+	if r.changes != nil {
+		r.changes.reset()
+	}
+}
+
+// ReplicaInfo describes a follower connected to the primary.
+type ReplicaInfo struct {
+	Addr  string `json:"addr"`  // Remote address of the follower
+	Acked uint64 `json:"acked"` // Last seq the follower reported as applied
+	Lag   uint64 `json:"lag"`   // Changes the follower is behind
+}
+
+// replica is a follower connection served by ServeReplication.
+type replica struct {
+	conn  net.Conn
+	acked atomic.Uint64
+	done  chan struct{} // Closed when the follower hangs up
+}
+
+// Serves followers on ln until it is closed, always returning a non-nil
+// error like http.Serve. The change log is kept from the first call on, so
+// followers first receive a snapshot and then every change in order.
+// Close ln before closing the Ranker. Snapshots only carry the head with
+// WithApproximateRanks, so that returns ErrNotSupported.
+func (r *Ranker) ServeReplication(ln net.Listener) error {
+	if r.approx != nil {
+		return ErrNotSupported
+	}
+	r.mu.Lock()
+	if r.changes == nil {
+		r.changes = newChangeLog(r.replBacklog)
+	}
+	r.mu.Unlock()
+
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			r.replMu.Lock()
+			for rep := range r.replicas {
+				rep.conn.Close()
+			}
+			r.replMu.Unlock()
+			return err
+		}
+
+		rep := &replica{conn: conn, done: make(chan struct{})}
+		r.replMu.Lock()
+		if r.replicas == nil {
+			r.replicas = make(map[*replica]struct{})
+		}
+		r.replicas[rep] = struct{}{}
+		r.replMu.Unlock()
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			addr := conn.RemoteAddr().String()
+			r.logger.Info("follower connected", "id", r.ID, "follower", addr)
+			err := r.serveReplica(rep)
+			conn.Close()
+			r.logger.Info("follower disconnected", "id", r.ID, "follower", addr, "err", err)
+			r.replMu.Lock()
+			delete(r.replicas, rep)
+			r.replMu.Unlock()
+		}()
+	}
+}
+
+// Returns the followers currently connected to this primary.
+func (r *Ranker) Replicas() []ReplicaInfo {
+	r.mu.RLock()
+	var latest uint64
+	if r.changes != nil {
+		latest = r.changes.next - 1
+	}
+	r.mu.RUnlock()
+
+	r.replMu.Lock()
+	defer r.replMu.Unlock()
+	infos := make([]ReplicaInfo, 0, len(r.replicas))
+	for rep := range r.replicas {
+		acked := rep.acked.Load()
+		infos = append(infos, ReplicaInfo{
+			Addr:  rep.conn.RemoteAddr().String(),
+			Acked: acked,
+			Lag:   latest - min(acked, latest),
+		})
+	}
+	return infos
+}
+
+// Streams changes to one follower until either side fails.
+func (r *Ranker) serveReplica(rep *replica) error {
+	<-r.Ready()
+	br := bufio.NewReader(rep.conn)
+	id, seq, err := readReplHandshake(br)
+	if err != nil {
+		return err
+	}
+	rep.acked.Store(seq)
+	go func() {
+		defer close(rep.done)
+		for {
+			seq, err := readReplAck(br)
+			if err != nil {
+				rep.conn.Close()
+				return
+			}
+			rep.acked.Store(seq)
+		}
+	}()
+
+	bw := bufio.NewWriter(rep.conn)
+	ticker := time.NewTicker(replPingInterval)
+	defer ticker.Stop()
+	next := seq + 1
+	for {
+		var image bytes.Buffer
+		r.mu.RLock()
+		if err := r.checkReady(); err != nil {
+			r.mu.RUnlock()
+			return err
+		}
+		log := r.changes
+		changes, ok := log.since(next, replBatchSize)
+		if !ok || log.id != id {
+			// The follower is too far behind or has another history.
+			id, next, changes = log.id, log.next, nil
+			err = writeImage(&image, r.zset)
+		}
+		wake := log.wake
+		r.mu.RUnlock()
+		if err != nil {
+			return err
+		}
+
+		if image.Len() > 0 {
+			writeReplFullSync(bw, id, next-1, image.Bytes())
+		}
+		for _, c := range changes {
+			writeReplChange(bw, c)
+		}
+		if err := bw.Flush(); err != nil {
+			return err
+		}
+		next += uint64(len(changes))
+		if len(changes) == replBatchSize {
+			continue
+		}
+
+		select {
+		case <-wake:
+		case <-rep.done:
+			return nil
+		case <-ticker.C:
+			r.mu.RLock()
+			latest := r.changes.next - 1
+			r.mu.RUnlock()
+			bw.WriteByte(replPing)
+			writeUint64(bw, latest)
+			if err := bw.Flush(); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// Replaces the whole leaderboard with z and rewrites the store to match,
+// see replaceWith, trimming it to the WithMaxSize cap.
+func (r *Ranker) replaceAll(z *ZSet) error {
+	return r.replaceWith(context.Background(), z)
+}
+
+func writeUint64(w *bufio.Writer, v uint64) {
+	var buf [8]byte
+	binary.LittleEndian.PutUint64(buf[:], v)
+	w.Write(buf[:])
+}
+
+func readUint64(r *bufio.Reader) (uint64, error) {
+	var buf [8]byte
+	if _, err := io.ReadFull(r, buf[:]); err != nil {
+		return 0, err
+	}
+	return binary.LittleEndian.Uint64(buf[:]), nil
+}
+
+func writeReplString(w *bufio.Writer, s string) {
+	var buf [binary.MaxVarintLen64]byte
+	w.Write(buf[:binary.PutUvarint(buf[:], uint64(len(s)))])
+	w.WriteString(s)
+}
+
+func readReplString(r *bufio.Reader) (string, error) {
+	n, err := binary.ReadUvarint(r)
+	if err != nil {
+		return "", err
+	}
+	if n > math.MaxInt32 {
+		return "", errReplProtocol
+	}
+	buf := make([]byte, n)
+	if _, err := io.ReadFull(r, buf); err != nil {
+		return "", err
+	}
+	return string(buf), nil
+}
+
+// Writes the follower handshake: magic, history id and last applied seq.
+func writeReplHandshake(w *bufio.Writer, id string, seq uint64) {
+	w.WriteString(replMagic)
+	writeReplString(w, id)
+	writeUint64(w, seq)
+}
+
+func readReplHandshake(r *bufio.Reader) (string, uint64, error) {
+	magic := make([]byte, len(replMagic))
+	if _, err := io.ReadFull(r, magic); err != nil {
+		return "", 0, err
+	}
+	if string(magic) != replMagic {
+		return "", 0, errReplProtocol
+	}
+	id, err := readReplString(r)
+	if err != nil {
+		return "", 0, err
+	}
+	seq, err := readUint64(r)
+	return id, seq, err
+}
+
+func writeReplFullSync(w *bufio.Writer, id string, seq uint64, image []byte) {
+	w.WriteByte(replFullSync)
+	writeReplString(w, id)
+	writeUint64(w, seq)
+	writeUint64(w, uint64(len(image)))
+	w.Write(image)
+}
+
+// Reads a full sync frame after its kind byte.
+func readReplFullSync(r *bufio.Reader) (string, uint64, *ZSet, error) {
+	id, err := readReplString(r)
+	if err != nil {
+		return "", 0, nil, err
+	}
+	seq, err := readUint64(r)
+	if err != nil {
+		return "", 0, nil, err
+	}
+	size, err := readUint64(r)
+	if err != nil {
+		return "", 0, nil, err
+	}
+	z, err := readImage(io.LimitReader(r, int64(size)))
+	return id, seq, z, err
+}
+
+func writeReplChange(w *bufio.Writer, c Change) {
+	w.WriteByte(replChange)
+	writeUint64(w, c.Seq)
+	w.WriteByte(byte(c.Op))
+	writeReplString(w, c.Key)
+	writeUint64(w, math.Float64bits(c.Value))
+}
+
+// Reads a change frame after its kind byte.
+func readReplChange(r *bufio.Reader) (Change, error) {
+	var c Change
+	var err error
+	if c.Seq, err = readUint64(r); err != nil {
+		return c, err
+	}
+	op, err := r.ReadByte()
+	if err != nil {
+		return c, err
+	}
+	c.Op = ChangeOp(op)
+	if c.Key, err = readReplString(r); err != nil {
+		return c, err
+	}
+	bits, err := readUint64(r)
+	c.Value = math.Float64frombits(bits)
+	return c, err
+}
+
+func readReplAck(r *bufio.Reader) (uint64, error) {
+	kind, err := r.ReadByte()
+	if err != nil {
+		return 0, err
+	}
+	if kind != replAck {
+		return 0, errReplProtocol
+	}
+	return readUint64(r)
+}
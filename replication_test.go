@@ -0,0 +1,133 @@
+package ranker
+
+import (
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func init() {
+	replPingInterval = 20 * time.Millisecond
+	replRetryInterval = 10 * time.Millisecond
+}
+
+// Starts a primary serving replication on a local port.
+func startPrimary(t *testing.T, opts ...Option) (*Ranker, string) {
+	r := New(append(opts, WithStore(NewMemoryStore()))...)
+	assert.NoError(t, r.Start())
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	done := make(chan struct{})
+	go func() {
+		r.ServeReplication(ln)
+		close(done)
+	}()
+	t.Cleanup(func() {
+		ln.Close()
+		<-done
+		r.Close()
+	})
+	return r, ln.Addr().String()
+}
+
+// Waits until the follower has every change of the primary.
+func assertReplicated(t *testing.T, primary, replica *Ranker) {
+	assert.Eventually(t, func() bool {
+		want, _ := primary.Range(0, -1)
+		got, _ := replica.Range(0, -1)
+		return assert.ObjectsAreEqual(want, got)
+	}, 2*time.Second, 5*time.Millisecond)
+}
+
+func TestReplication(t *testing.T) {
+	primary, addr := startPrimary(t)
+	assert.NoError(t, primary.Update("a", 1))
+	assert.NoError(t, primary.Update("b", 2))
+
+	replica := New(WithStore(NewMemoryStore()))
+	assert.NoError(t, replica.Start())
+	defer replica.Close()
+	// Stale state is replaced by the first full sync.
+	assert.NoError(t, replica.Update("stale", 9))
+
+	f := NewFollower(replica, addr)
+	f.Start()
+	defer f.Close()
+	assertReplicated(t, primary, replica)
+
+	assert.NoError(t, primary.Update("c", 3))
+	_, err := primary.IncrBy("a", 5)
+	assert.NoError(t, err)
+	assert.NoError(t, primary.Remove("b"))
+	assertReplicated(t, primary, replica)
+	assert.NoError(t, replica.Verify())
+
+	assert.Eventually(t, func() bool {
+		status := f.Status()
+		return status.Connected && status.Lag == 0 && status.Applied == 3
+	}, 2*time.Second, 5*time.Millisecond)
+	assert.Equal(t, 1, f.Status().FullSyncs)
+	assert.Eventually(t, func() bool {
+		replicas := primary.Replicas()
+		return len(replicas) == 1 && replicas[0].Acked == 3 && replicas[0].Lag == 0
+	}, 2*time.Second, 5*time.Millisecond)
+}
+
+// Creates a follower continuing from the position of a closed one.
+func resume(r *Ranker, addr string, prev *Follower) *Follower {
+	f := NewFollower(r, addr)
+	f.id, f.seq, f.primary = prev.id, prev.seq, prev.primary
+	return f
+}
+
+func TestReplication_Resync(t *testing.T) {
+	primary, addr := startPrimary(t, WithReplicationBacklog(4))
+	replica := New(WithStore(NewMemoryStore()))
+	assert.NoError(t, replica.Start())
+	defer replica.Close()
+
+	f := NewFollower(replica, addr)
+	f.Start()
+	assert.NoError(t, primary.Update("a", 1))
+	assertReplicated(t, primary, replica)
+	f.Close()
+	assert.False(t, f.Status().Connected)
+
+	// A short gap is filled from the backlog.
+	assert.NoError(t, primary.Update("b", 2))
+	f = resume(replica, addr, f)
+	f.Start()
+	assertReplicated(t, primary, replica)
+	assert.Equal(t, 0, f.Status().FullSyncs)
+	f.Close()
+
+	// A gap longer than the backlog needs a snapshot.
+	for i := 0; i < 10; i++ {
+		_, err := primary.IncrBy("c", 1)
+		assert.NoError(t, err)
+	}
+	f = resume(replica, addr, f)
+	f.Start()
+	defer f.Close()
+	assertReplicated(t, primary, replica)
+	assert.Equal(t, 1, f.Status().FullSyncs)
+
+	// Bulk changes start a new history.
+	_, err := primary.Import(strings.NewReader("x,1\ny,2\n"), FormatCSV, ImportReplace)
+	assert.NoError(t, err)
+	assertReplicated(t, primary, replica)
+	assert.Equal(t, 2, f.Status().FullSyncs)
+}
+
+func TestReplication_Approximate(t *testing.T) {
+	r := New(WithStore(NewMemoryStore()), WithApproximateRanks(10, 8))
+	assert.NoError(t, r.Start())
+	defer r.Close()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	defer ln.Close()
+	assert.ErrorIs(t, r.ServeReplication(ln), ErrNotSupported)
+}
@@ -0,0 +1,125 @@
+package ranker
+
+import (
+	"context"
+	"log/slog"
+)
+
+// Returns a copy of the leaderboard as a ZSet, to combine with ZUnion,
+// ZInter and ZDiff. With WithApproximateRanks only the head is copied.
+func (r *Ranker) Copy() (*ZSet, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if err := r.checkReady(); err != nil {
+		return nil, err
+	}
+	return NewZSetFromSorted(r.zset.All())
+}
+
+// Replaces the whole leaderboard with the players in z, in the store as
+// well as in memory, like the STORE variants of the Redis set commands.
+// z is copied and may be reused. The WithMaxSize cap applies.
+func (r *Ranker) Store(z *ZSet) error {
+	return r.StoreContext(context.Background(), z)
+}
+
+// Like Store, with ctx for tracing and cancellation.
+func (r *Ranker) StoreContext(ctx context.Context, z *ZSet) (err error) {
+	if z == nil {
+		return ErrInvalidParams
+	}
+	op := r.begin(ctx, opStore, slog.Int("players", z.ZCard()))
+	defer op.end(&err)
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	copied, err := NewZSetFromSorted(z.All())
+	if err != nil {
+		return err
+	}
+	_, err = r.replace(ctx, copied)
+	return err
+}
+
+// Replaces the leaderboard with the union of the sources, see ZUnion, and
+// returns the number of players stored. The receiver may be one of the
+// sources.
+func (r *Ranker) UnionStore(sources []*Ranker, options *ZAggregateOptions) (int, error) {
+	return r.UnionStoreContext(context.Background(), sources, options)
+}
+
+// Like UnionStore, with ctx for tracing and cancellation.
+func (r *Ranker) UnionStoreContext(ctx context.Context, sources []*Ranker, options *ZAggregateOptions) (_ int, err error) {
+	op := r.begin(ctx, opUnionStore, slog.Int("sources", len(sources)))
+	defer op.end(&err)
+	return r.combineStore(ctx, sources, func(sets []*ZSet) (*ZSet, error) {
+		return ZUnion(sets, options)
+	})
+}
+
+// Replaces the leaderboard with the intersection of the sources, see
+// ZInter, and returns the number of players stored.
+func (r *Ranker) InterStore(sources []*Ranker, options *ZAggregateOptions) (int, error) {
+	return r.InterStoreContext(context.Background(), sources, options)
+}
+
+// Like InterStore, with ctx for tracing and cancellation.
+func (r *Ranker) InterStoreContext(ctx context.Context, sources []*Ranker, options *ZAggregateOptions) (_ int, err error) {
+	op := r.begin(ctx, opInterStore, slog.Int("sources", len(sources)))
+	defer op.end(&err)
+	return r.combineStore(ctx, sources, func(sets []*ZSet) (*ZSet, error) {
+		return ZInter(sets, options)
+	})
+}
+
+// Replaces the leaderboard with the players of the first source missing
+// from all the others, see ZDiff, and returns the number of players stored.
+func (r *Ranker) DiffStore(sources []*Ranker) (int, error) {
+	return r.DiffStoreContext(context.Background(), sources)
+}
+
+// Like DiffStore, with ctx for tracing and cancellation.
+func (r *Ranker) DiffStoreContext(ctx context.Context, sources []*Ranker) (_ int, err error) {
+	op := r.begin(ctx, opDiffStore, slog.Int("sources", len(sources)))
+	defer op.end(&err)
+	return r.combineStore(ctx, sources, ZDiff)
+}
+
+// Copies the sources one at a time, combines the copies and stores the
+// result. Sources are read under their own locks and not as of a single
+// point in time.
+func (r *Ranker) combineStore(ctx context.Context, sources []*Ranker, combine func([]*ZSet) (*ZSet, error)) (int, error) {
+	sets := make([]*ZSet, len(sources))
+	for i, source := range sources {
+		if err := ctx.Err(); err != nil {
+			return 0, err
+		}
+		z, err := source.Copy()
+		if err != nil {
+			return 0, err
+		}
+		sets[i] = z
+	}
+	z, err := combine(sets)
+	if err != nil {
+		return 0, err
+	}
+	return r.replace(ctx, z)
+}
+
+// Replaces the leaderboard with z unless it is still loading, checked under
+// the same lock, and returns the number of players kept under the
+// WithMaxSize cap.
+func (r *Ranker) replace(ctx context.Context, z *ZSet) (int, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	if err := r.replaceWith(ctx, z); err != nil {
+		return 0, err
+	}
+	n := z.ZCard()
+	if r.maxSize > 0 {
+		n = min(n, r.maxSize)
+	}
+	return n, nil
+}
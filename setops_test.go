@@ -0,0 +1,157 @@
+package ranker
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func startMemory(t *testing.T, scores map[string]float64, opts ...Option) *Ranker {
+	r := New(append([]Option{WithStore(NewMemoryStore())}, opts...)...)
+	assert.NoError(t, r.Start())
+	for player, score := range scores {
+		assert.NoError(t, r.Update(player, score))
+	}
+	return r
+}
+
+func TestRanker_Store(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "rank")
+	r := New(WithStorageDir(dir))
+	assert.NoError(t, r.Start())
+	assert.NoError(t, r.Update("old", 100))
+
+	z := zsetOf("a", 1.0, "b", 2.0)
+	assert.NoError(t, r.Store(z))
+	z.ZAdd(3, "c") // The ranker keeps its own copy.
+	assert.Equal(t, 2, r.Count())
+	assert.NoError(t, r.Verify())
+
+	copied, err := r.Copy()
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]float64{"a": 1, "b": 2}, zsetScores(copied))
+	r.Close()
+
+	// The store was rewritten too.
+	r = New(WithStorageDir(dir))
+	assert.NoError(t, r.Start())
+	defer r.Close()
+	assert.Equal(t, 2, r.Count())
+	_, err = r.Score("old")
+	assert.ErrorIs(t, err, ErrKeyNotExist)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.ErrorIs(t, r.StoreContext(ctx, NewZSet()), context.Canceled)
+	assert.Equal(t, 2, r.Count())
+}
+
+// failingStore is a MemoryStore whose batches fail to delete or commit
+// once broken.
+type failingStore struct {
+	*MemoryStore
+	broken bool
+}
+
+type failingBatch struct {
+	Batch
+	store *failingStore
+}
+
+func (s *failingStore) NewBatch() Batch {
+	return &failingBatch{Batch: s.MemoryStore.NewBatch(), store: s}
+}
+
+func (b *failingBatch) Delete(key []byte) error {
+	if b.store.broken {
+		return errors.New("delete failed")
+	}
+	return b.Batch.Delete(key)
+}
+
+func (b *failingBatch) Commit() error {
+	if b.store.broken {
+		return errors.New("commit failed")
+	}
+	return b.Batch.Commit()
+}
+
+func TestRanker_StoreFailure(t *testing.T) {
+	store := &failingStore{MemoryStore: NewMemoryStore()}
+	r := New(WithStore(store))
+	assert.NoError(t, r.Start())
+	defer r.Close()
+	assert.NoError(t, r.Update("old", 100))
+
+	assert.ErrorIs(t, r.Store(nil), ErrInvalidParams)
+
+	// A failed commit leaves the store and the board as they were.
+	store.broken = true
+	assert.Error(t, r.Store(zsetOf("a", 1.0, "b", 2.0)))
+	store.broken = false
+	assert.Equal(t, 1, r.Count())
+	score, err := r.Score("old")
+	assert.NoError(t, err)
+	assert.Equal(t, float64(100), score)
+	assert.NoError(t, r.Verify())
+}
+
+func TestRanker_SetAlgebraStore(t *testing.T) {
+	week1 := startMemory(t, map[string]float64{"a": 10, "b": 20})
+	week2 := startMemory(t, map[string]float64{"b": 5, "c": 30})
+	defer week1.Close()
+	defer week2.Close()
+
+	season := startMemory(t, map[string]float64{"stale": 1})
+	defer season.Close()
+	n, err := season.UnionStore([]*Ranker{week1, week2}, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, n)
+	entries, err := season.Range(0, -1)
+	assert.NoError(t, err)
+	assert.Equal(t, []*Entry{{Rank: 0, Score: 30, Key: "c"}, {Rank: 1, Score: 25, Key: "b"}, {Rank: 2, Score: 10, Key: "a"}}, entries)
+
+	// The destination can be a source.
+	n, err = season.UnionStore([]*Ranker{season, week1}, &ZAggregateOptions{Weights: []float64{1, -1}})
+	assert.NoError(t, err)
+	assert.Equal(t, 3, n)
+	score, err := season.Score("b")
+	assert.NoError(t, err)
+	assert.Equal(t, float64(5), score)
+
+	both := startMemory(t, nil)
+	defer both.Close()
+	n, err = both.InterStore([]*Ranker{week1, week2}, &ZAggregateOptions{Aggregate: AggregateMax})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, n)
+	score, err = both.Score("b")
+	assert.NoError(t, err)
+	assert.Equal(t, float64(20), score)
+
+	n, err = both.DiffStore([]*Ranker{week1, week2})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, n)
+	score, err = both.Score("a")
+	assert.NoError(t, err)
+	assert.Equal(t, float64(10), score)
+	assert.Equal(t, 1, both.Count())
+
+	// The cap applies to the result.
+	capped := startMemory(t, nil, WithMaxSize(2))
+	defer capped.Close()
+	n, err = capped.UnionStore([]*Ranker{week1, week2}, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, n)
+	assert.Equal(t, 2, capped.Count())
+	_, err = capped.Score("a")
+	assert.ErrorIs(t, err, ErrKeyNotExist)
+
+	_, err = both.UnionStore(nil, nil)
+	assert.ErrorIs(t, err, ErrInvalidParams)
+	_, err = both.InterStore([]*Ranker{week1}, &ZAggregateOptions{Weights: []float64{1, 2}})
+	assert.ErrorIs(t, err, ErrInvalidParams)
+	assert.Equal(t, 1, both.Count())
+}
@@ -0,0 +1,207 @@
+package ranker
+
+import (
+	"container/heap"
+	"errors"
+	"hash/fnv"
+	"math"
+	"sync"
+)
+
+// Shard is a part of a sharded leaderboard, implemented by *Ranker for
+// in-process shards and by *RemoteShard for shards served by ServeShard.
+type Shard interface {
+	Update(playerID string, score float64) error
+	IncrBy(playerID string, increment float64) (float64, error)
+	Remove(playerID string) error
+	Score(playerID string) (float64, error)
+	Range(start, end int) ([]*Entry, error)
+	CountByScore(min, max float64) (int, error)
+	CountAbove(score float64, playerID string) (int, error)
+}
+
+// Sharded is a leaderboard partitioned across shards by a hash of the
+// player ID. Writes and score lookups go to the owning shard; a global rank
+// is the number of players ranked ahead on every shard, and global ranges
+// merge the top entries of every shard.
+//
+// Queries touching several shards are not atomic: writes landing while
+// they run may or may not be reflected. The shard order decides placement,
+// so it must stay the same for a given set of shards.
+type Sharded struct {
+	shards []Shard
+}
+
+// Creates a sharded leaderboard over shards, which must not be empty.
+func NewSharded(shards ...Shard) *Sharded {
+	return &Sharded{shards: shards}
+}
+
+// Returns the shards in placement order.
+func (s *Sharded) Shards() []Shard {
+	return s.shards
+}
+
+// Returns the shard owning a player.
+func (s *Sharded) shard(playerID string) Shard {
+	h := fnv.New64a()
+	h.Write(unsafeStringToBytes(playerID))
+	return s.shards[h.Sum64()%uint64(len(s.shards))]
+}
+
+// Runs fn on every shard concurrently and joins the errors.
+func (s *Sharded) each(fn func(i int, shard Shard) error) error {
+	errs := make([]error, len(s.shards))
+	var wg sync.WaitGroup
+	for i, shard := range s.shards {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs[i] = fn(i, shard)
+		}()
+	}
+	wg.Wait()
+	return errors.Join(errs...)
+}
+
+// Updates or adds a player's score on its shard.
+func (s *Sharded) Update(playerID string, score float64) error {
+	return s.shard(playerID).Update(playerID, score)
+}
+
+// Adds increment to a player's score on its shard.
+func (s *Sharded) IncrBy(playerID string, increment float64) (float64, error) {
+	return s.shard(playerID).IncrBy(playerID, increment)
+}
+
+// Removes a player from its shard.
+func (s *Sharded) Remove(playerID string) error {
+	return s.shard(playerID).Remove(playerID)
+}
+
+// Retrieves a player's score from its shard.
+func (s *Sharded) Score(playerID string) (float64, error) {
+	return s.shard(playerID).Score(playerID)
+}
+
+// Returns the number of players on all shards.
+func (s *Sharded) Count() (int, error) {
+	return s.CountByScore(math.Inf(-1), math.Inf(1))
+}
+
+// Returns the number of players on all shards with a score between min
+// and max inclusive.
+func (s *Sharded) CountByScore(min, max float64) (int, error) {
+	counts := make([]int, len(s.shards))
+	err := s.each(func(i int, shard Shard) (err error) {
+		counts[i], err = shard.CountByScore(min, max)
+		return err
+	})
+	return sum(counts), err
+}
+
+// Retrieves the global rank of a player: the players ranked ahead of it
+// on every shard, with ties ordered by ID as within a single Ranker.
+func (s *Sharded) Rank(playerID string) (*Entry, error) {
+	score, err := s.Score(playerID)
+	if err != nil {
+		return nil, err
+	}
+	counts := make([]int, len(s.shards))
+	err = s.each(func(i int, shard Shard) (err error) {
+		counts[i], err = shard.CountAbove(score, playerID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &Entry{Rank: sum(counts), Score: score, Key: playerID}, nil
+}
+
+// Retrieves a range of global ranking entries, start and end are inclusive
+// ranks and negative ones count from the end. Every shard returns its top
+// end+1 entries, which are merged in rank order.
+func (s *Sharded) Range(start, end int) ([]*Entry, error) {
+	if start < 0 || end < 0 {
+		count, err := s.Count()
+		if err != nil {
+			return nil, err
+		}
+		if start < 0 {
+			start = max(start+count, 0)
+		}
+		if end < 0 {
+			end += count
+		}
+	}
+	if end < start {
+		return []*Entry{}, nil
+	}
+
+	runs := make([][]*Entry, len(s.shards))
+	err := s.each(func(i int, shard Shard) (err error) {
+		runs[i], err = shard.Range(0, end)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	entries := mergeEntries(runs, end+1)
+	entries = entries[min(start, len(entries)):]
+	for i, entry := range entries {
+		entry.Rank = start + i
+	}
+	return entries, nil
+}
+
+func sum(values []int) int {
+	total := 0
+	for _, v := range values {
+		total += v
+	}
+	return total
+}
+
+// entryHeap orders the heads of ranked runs, best first.
+type entryHeap struct {
+	runs [][]*Entry
+	idx  []int // Indices into runs, kept as a heap
+}
+
+func (h *entryHeap) Len() int { return len(h.idx) }
+func (h *entryHeap) Less(i, j int) bool {
+	a, b := h.runs[h.idx[i]][0], h.runs[h.idx[j]][0]
+	return a.Score > b.Score || (a.Score == b.Score && a.Key > b.Key)
+}
+func (h *entryHeap) Swap(i, j int) { h.idx[i], h.idx[j] = h.idx[j], h.idx[i] }
+func (h *entryHeap) Push(x any)    { h.idx = append(h.idx, x.(int)) }
+func (h *entryHeap) Pop() any {
+	x := h.idx[len(h.idx)-1]
+	h.idx = h.idx[:len(h.idx)-1]
+	return x
+}
+
+// Merges runs in rank order into at most n entries.
+func mergeEntries(runs [][]*Entry, n int) []*Entry {
+	h := &entryHeap{runs: runs}
+	for i, run := range runs {
+		if len(run) > 0 {
+			h.idx = append(h.idx, i)
+		}
+	}
+	heap.Init(h)
+
+	entries := make([]*Entry, 0, n)
+	for h.Len() > 0 && len(entries) < n {
+		i := h.idx[0]
+		entries = append(entries, runs[i][0])
+		runs[i] = runs[i][1:]
+		if len(runs[i]) == 0 {
+			heap.Pop(h)
+		} else {
+			heap.Fix(h, 0)
+		}
+	}
+	return entries
+}
@@ -0,0 +1,189 @@
+package ranker
+
+import (
+	"errors"
+	"net"
+	"net/rpc"
+	"sync"
+)
+
+// ShardRequest carries the arguments of a remote shard call.
+type ShardRequest struct {
+	PlayerID string
+	Score    float64 // Score, increment or lower bound
+	Max      float64 // Upper bound of CountByScore
+	Start    int
+	End      int
+}
+
+// ShardResponse carries the results of a remote shard call.
+type ShardResponse struct {
+	Score   float64
+	Count   int
+	Entries []*Entry
+}
+
+// Errors that keep their identity across the wire.
+var shardErrors = []error{ErrKeyNotExist, ErrInvalidParams, ErrWarming, ErrNotLeader}
+
+// Serves r as a shard for DialShard on ln until it is closed, always
+// returning a non-nil error.
+func ServeShard(r *Ranker, ln net.Listener) error {
+	srv := rpc.NewServer()
+	if err := srv.RegisterName("Shard", &shardService{r: r}); err != nil {
+		return err
+	}
+
+	var mu sync.Mutex
+	conns := make(map[net.Conn]struct{})
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			mu.Lock()
+			for conn := range conns {
+				conn.Close()
+			}
+			mu.Unlock()
+			return err
+		}
+		mu.Lock()
+		conns[conn] = struct{}{}
+		mu.Unlock()
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			srv.ServeConn(conn)
+			mu.Lock()
+			delete(conns, conn)
+			mu.Unlock()
+		}()
+	}
+}
+
+// shardService exposes a Ranker over net/rpc.
+type shardService struct {
+	r *Ranker
+}
+
+func (s *shardService) Update(req ShardRequest, resp *ShardResponse) error {
+	return s.r.Update(req.PlayerID, req.Score)
+}
+
+func (s *shardService) IncrBy(req ShardRequest, resp *ShardResponse) (err error) {
+	resp.Score, err = s.r.IncrBy(req.PlayerID, req.Score)
+	return err
+}
+
+func (s *shardService) Remove(req ShardRequest, resp *ShardResponse) error {
+	return s.r.Remove(req.PlayerID)
+}
+
+func (s *shardService) Score(req ShardRequest, resp *ShardResponse) (err error) {
+	resp.Score, err = s.r.Score(req.PlayerID)
+	return err
+}
+
+func (s *shardService) Range(req ShardRequest, resp *ShardResponse) (err error) {
+	resp.Entries, err = s.r.Range(req.Start, req.End)
+	return err
+}
+
+func (s *shardService) CountByScore(req ShardRequest, resp *ShardResponse) (err error) {
+	resp.Count, err = s.r.CountByScore(req.Score, req.Max)
+	return err
+}
+
+func (s *shardService) CountAbove(req ShardRequest, resp *ShardResponse) (err error) {
+	resp.Count, err = s.r.CountAbove(req.Score, req.PlayerID)
+	return err
+}
+
+// RemoteShard is a Shard served by ServeShard in another process.
+type RemoteShard struct {
+	client *rpc.Client
+}
+
+// Connects to a shard served by ServeShard at addr.
+func DialShard(addr string) (*RemoteShard, error) {
+	client, err := rpc.Dial("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	return &RemoteShard{client: client}, nil
+}
+
+// Closes the connection.
+func (s *RemoteShard) Close() error {
+	return s.client.Close()
+}
+
+// Calls a shard method, restoring well-known errors.
+func (s *RemoteShard) call(method string, req ShardRequest) (*ShardResponse, error) {
+	var resp ShardResponse
+	err := s.client.Call("Shard."+method, req, &resp)
+	var serverErr rpc.ServerError
+	if errors.As(err, &serverErr) {
+		for _, known := range shardErrors {
+			if string(serverErr) == known.Error() {
+				return nil, known
+			}
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+func (s *RemoteShard) Update(playerID string, score float64) error {
+	_, err := s.call("Update", ShardRequest{PlayerID: playerID, Score: score})
+	return err
+}
+
+func (s *RemoteShard) IncrBy(playerID string, increment float64) (float64, error) {
+	resp, err := s.call("IncrBy", ShardRequest{PlayerID: playerID, Score: increment})
+	if err != nil {
+		return 0, err
+	}
+	return resp.Score, nil
+}
+
+func (s *RemoteShard) Remove(playerID string) error {
+	_, err := s.call("Remove", ShardRequest{PlayerID: playerID})
+	return err
+}
+
+func (s *RemoteShard) Score(playerID string) (float64, error) {
+	resp, err := s.call("Score", ShardRequest{PlayerID: playerID})
+	if err != nil {
+		return 0, err
+	}
+	return resp.Score, nil
+}
+
+func (s *RemoteShard) Range(start, end int) ([]*Entry, error) {
+	resp, err := s.call("Range", ShardRequest{Start: start, End: end})
+	if err != nil {
+		return nil, err
+	}
+	return resp.Entries, nil
+}
+
+func (s *RemoteShard) CountByScore(min, max float64) (int, error) {
+	resp, err := s.call("CountByScore", ShardRequest{Score: min, Max: max})
+	if err != nil {
+		return 0, err
+	}
+	return resp.Count, nil
+}
+
+func (s *RemoteShard) CountAbove(score float64, playerID string) (int, error) {
+	resp, err := s.call("CountAbove", ShardRequest{Score: score, PlayerID: playerID})
+	if err != nil {
+		return 0, err
+	}
+	return resp.Count, nil
+}
@@ -0,0 +1,110 @@
+package ranker
+
+import (
+	"fmt"
+	"math/rand"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Starts an in-memory Ranker for use as a shard.
+func startShard(t *testing.T) *Ranker {
+	r := New(WithStore(NewMemoryStore()))
+	assert.NoError(t, r.Start())
+	t.Cleanup(r.Close)
+	return r
+}
+
+// Checks global ranks and ranges against a single reference set.
+func assertSharded(t *testing.T, s *Sharded, ref *ZSet) {
+	count, err := s.Count()
+	assert.NoError(t, err)
+	assert.Equal(t, ref.ZCard(), count)
+
+	for _, item := range mustRange(ref) {
+		entry, err := s.Rank(item.Member.(string))
+		assert.NoError(t, err)
+		rank, _ := ref.ZRevRank(item.Member.(string))
+		assert.Equal(t, int(rank), entry.Rank)
+	}
+
+	for _, span := range [][2]int{{0, 49}, {10, 20}, {-5, -1}, {0, -1}, {count, count + 5}} {
+		entries, err := s.Range(span[0], span[1])
+		assert.NoError(t, err)
+		items, _ := ref.ZRevRangeWithScores(span[0], span[1])
+		assert.Equal(t, len(items), len(entries))
+		for i, item := range items {
+			assert.Equal(t, item.Member, entries[i].Key)
+			assert.Equal(t, item.Score, entries[i].Score)
+			rank, _ := ref.ZRevRank(entries[i].Key)
+			assert.Equal(t, int(rank), entries[i].Rank)
+		}
+	}
+}
+
+func mustRange(z *ZSet) []Z {
+	items, _ := z.ZRangeWithScores(0, -1)
+	return items
+}
+
+func TestSharded(t *testing.T) {
+	s := NewSharded(startShard(t), startShard(t), startShard(t), startShard(t))
+	ref := NewZSet()
+	rnd := rand.New(rand.NewSource(1))
+	for i := 0; i < 500; i++ {
+		key := fmt.Sprintf("p%03d", i)
+		score := float64(rnd.Intn(50)) // Plenty of ties across shards
+		assert.NoError(t, s.Update(key, score))
+		ref.ZAdd(score, key)
+	}
+	score, err := s.IncrBy("p001", 100)
+	assert.NoError(t, err)
+	ref.ZIncrBy(100, "p001")
+	assert.NoError(t, s.Remove("p002"))
+	ref.ZRem("p002")
+	assert.ErrorIs(t, s.Remove("p002"), ErrKeyNotExist)
+
+	assertSharded(t, s, ref)
+	entry, err := s.Rank("p001")
+	assert.NoError(t, err)
+	assert.Equal(t, &Entry{Rank: 0, Score: score, Key: "p001"}, entry)
+	_, err = s.Rank("missing")
+	assert.ErrorIs(t, err, ErrKeyNotExist)
+
+	// Every shard got a share.
+	for _, shard := range s.Shards() {
+		assert.Greater(t, shard.(*Ranker).Count(), 50)
+	}
+}
+
+func TestSharded_Remote(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	done := make(chan struct{})
+	go func() {
+		ServeShard(startShard(t), ln)
+		close(done)
+	}()
+	defer func() {
+		ln.Close()
+		<-done
+	}()
+
+	remote, err := DialShard(ln.Addr().String())
+	assert.NoError(t, err)
+	defer remote.Close()
+
+	s := NewSharded(startShard(t), remote)
+	ref := NewZSet()
+	for i := 0; i < 100; i++ {
+		key := fmt.Sprintf("p%03d", i)
+		assert.NoError(t, s.Update(key, float64(i%7)))
+		ref.ZAdd(float64(i%7), key)
+	}
+	assertSharded(t, s, ref)
+
+	_, err = remote.Score("missing")
+	assert.ErrorIs(t, err, ErrKeyNotExist)
+}
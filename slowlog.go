@@ -0,0 +1,84 @@
+package ranker
+
+import (
+	"sync"
+	"time"
+)
+
+const defaultSlowlogSize = 128 // Entries kept in the slowlog, like Redis
+
+// SlowlogEntry is an operation that took longer than the slow threshold.
+type SlowlogEntry struct {
+	ID       int64         `json:"id"`       // Increases with every entry, even after a reset
+	Time     time.Time     `json:"time"`     // When the operation started
+	Duration time.Duration `json:"duration"` // How long it took, including waiting for the lock
+	Op       string        `json:"op"`       // Name of the operation
+	Args     []string      `json:"args"`     // Arguments of the operation
+	Err      string        `json:"err,omitempty"`
+}
+
+// Configures how many slow operations the slowlog keeps, see Slowlog and
+// WithSlowThreshold. Zero or less disables the slowlog.
+func WithSlowlogSize(n int) Option {
+	return func(r *Ranker) {
+		r.slowlog.size = max(n, 0)
+	}
+}
+
+// slowlog keeps the most recent slow operations in a ring buffer.
+type slowlog struct {
+	mu      sync.Mutex
+	size    int
+	entries []SlowlogEntry // Ring of up to size entries
+	next    int            // Index of the next write into entries
+	nextID  int64          // ID of the next entry
+}
+
+// Records an entry, dropping the oldest one when full.
+func (l *slowlog) add(entry SlowlogEntry) {
+	if l.size == 0 {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	entry.ID = l.nextID
+	l.nextID++
+	if len(l.entries) < l.size {
+		l.entries = append(l.entries, entry)
+	} else {
+		l.entries[l.next] = entry
+	}
+	l.next = (l.next + 1) % l.size
+}
+
+// Returns up to n of the most recent slow operations, newest first; n below
+// zero returns all of them.
+func (r *Ranker) Slowlog(n int) []SlowlogEntry {
+	l := &r.slowlog
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	count := len(l.entries)
+	if n >= 0 {
+		count = min(n, count)
+	}
+	entries := make([]SlowlogEntry, count)
+	for i := range entries {
+		entries[i] = l.entries[(l.next-1-i+len(l.entries))%len(l.entries)]
+	}
+	return entries
+}
+
+// Returns the number of entries in the slowlog.
+func (r *Ranker) SlowlogLen() int {
+	r.slowlog.mu.Lock()
+	defer r.slowlog.mu.Unlock()
+	return len(r.slowlog.entries)
+}
+
+// Empties the slowlog.
+func (r *Ranker) ResetSlowlog() {
+	r.slowlog.mu.Lock()
+	defer r.slowlog.mu.Unlock()
+	r.slowlog.entries = nil
+	r.slowlog.next = 0
+}
@@ -0,0 +1,57 @@
+package ranker
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRanker_Slowlog(t *testing.T) {
+	r := New(WithStore(NewMemoryStore()), WithSlowThreshold(time.Nanosecond), WithSlowlogSize(3))
+	assert.NoError(t, r.Start())
+	defer r.Close()
+
+	assert.NoError(t, r.Update("a", 1))
+	assert.NoError(t, r.Update("b", 2))
+	_, err := r.Range(0, -1)
+	assert.NoError(t, err)
+	_, err = r.Rank("missing")
+	assert.ErrorIs(t, err, ErrKeyNotExist)
+
+	// The oldest entry was dropped, the newest comes first.
+	assert.Equal(t, 3, r.SlowlogLen())
+	entries := r.Slowlog(-1)
+	assert.Len(t, entries, 3)
+	assert.Equal(t, int64(3), entries[0].ID)
+	assert.Equal(t, opRank, entries[0].Op)
+	assert.Equal(t, []string{"missing"}, entries[0].Args)
+	assert.Equal(t, ErrKeyNotExist.Error(), entries[0].Err)
+	assert.Equal(t, opRange, entries[1].Op)
+	assert.Equal(t, []string{"0", "-1"}, entries[1].Args)
+	assert.Equal(t, opUpdate, entries[2].Op)
+	assert.Equal(t, []string{"b", "2"}, entries[2].Args)
+	assert.Positive(t, entries[2].Duration)
+
+	assert.Len(t, r.Slowlog(1), 1)
+	r.ResetSlowlog()
+	assert.Empty(t, r.Slowlog(-1))
+	assert.NoError(t, r.Update("c", 3))
+	entries = r.Slowlog(10)
+	assert.Len(t, entries, 1)
+	assert.Equal(t, int64(4), entries[0].ID)
+}
+
+func TestRanker_SlowlogDisabled(t *testing.T) {
+	r := New(WithStore(NewMemoryStore()), WithSlowThreshold(0))
+	assert.NoError(t, r.Start())
+	defer r.Close()
+	assert.NoError(t, r.Update("a", 1))
+	assert.Equal(t, 0, r.SlowlogLen())
+
+	r = New(WithStore(NewMemoryStore()), WithSlowThreshold(time.Nanosecond), WithSlowlogSize(0))
+	assert.NoError(t, r.Start())
+	defer r.Close()
+	assert.NoError(t, r.Update("a", 1))
+	assert.Empty(t, r.Slowlog(-1))
+}
@@ -0,0 +1,208 @@
+package ranker
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+)
+
+// Writes a point-in-time copy of the leaderboard to dir, which must not exist.
+// The store must implement Checkpointer, otherwise ErrNotSupported is returned.
+//
+// With the default Pebble store the snapshot is a checkpoint: sstables are
+// hard-linked and the WAL is copied, while writes go on. The checkpoint holds
+// the store as of a single moment, and every update touches the store and the
+// in-memory set under the same lock, so it holds exactly the board that was
+// ranked at that moment. The directory can be opened by
+// any Ranker via WithStorageDir, or brought back into this one with Restore.
+func (r *Ranker) Snapshot(dir string) error {
+	return r.SnapshotContext(context.Background(), dir)
+}
+
+// Like Snapshot, with ctx for tracing and cancellation.
+func (r *Ranker) SnapshotContext(ctx context.Context, dir string) (err error) {
+	op := r.begin(ctx, opSnapshot, slog.String("dir", dir))
+	defer op.end(&err)
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	// The store guards the checkpoint against being closed meanwhile, so
+	// the lock is only needed to fetch it.
+	r.mu.RLock()
+	store := r.store
+	r.mu.RUnlock()
+
+	if store == nil {
+		return ErrStoreClosed
+	}
+	cp, ok := store.(Checkpointer)
+	if !ok {
+		return ErrNotSupported
+	}
+	return cp.Checkpoint(dir)
+}
+
+// Replaces the leaderboard with the contents of a snapshot directory.
+// The snapshot is copied, so dir stays usable for later restores. Only the
+// Pebble store supports this, other stores return ErrNotSupported.
+//
+// The copy is staged in a sibling of the storage directory and loaded
+// before it is renamed over the live one, so a failed copy or load leaves
+// the current board and its store as they were.
+func (r *Ranker) Restore(dir string) error {
+	return r.RestoreContext(context.Background(), dir)
+}
+
+// Like Restore, with ctx for tracing and cancellation. Canceling stops the
+// copy or the load of the staged board, leaving the current one in place.
+func (r *Ranker) RestoreContext(ctx context.Context, dir string) (err error) {
+	op := r.begin(ctx, opRestore, slog.String("dir", dir))
+	defer op.end(&err)
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if _, err := os.Stat(dir); err != nil {
+		return err
+	}
+
+	r.loading.Wait()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	ps, ok := r.store.(*PebbleStore)
+	if !ok {
+		return ErrNotSupported
+	}
+	live := ps.Dir()
+	staged, err := os.MkdirTemp(filepath.Dir(live), filepath.Base(live)+".restore-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(staged)
+	if err := copyDir(ctx, dir, staged); err != nil {
+		return err
+	}
+	if err := r.loadStaged(ctx, staged); err != nil {
+		return err
+	}
+
+	// The staged copy loads, swap the directories.
+	if err := r.switchStore(ps, staged); err != nil {
+		return err
+	}
+
+	r.resetChanges()
+	r.warming = false
+	r.loaded = true
+	r.loadErr = nil
+	r.pending = nil
+	return nil
+}
+
+// Opens the staged copy of a snapshot and loads the board from it, the
+// caller holds the lock. The board is only replaced when the load succeeds.
+func (r *Ranker) loadStaged(ctx context.Context, dir string) error {
+	opts := r.pebbleOptions()
+	opts.ErrorIfNotExists = true
+	store, err := OpenPebbleStore(dir, opts)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	live, zset := r.store, r.zset
+	var hist *scoreHistogram
+	if r.approx != nil {
+		hist = r.approx.hist
+	}
+	r.store = store
+	defer func() { r.store = live }()
+
+	if err := r.reload(ctx); err != nil {
+		r.zset = zset
+		if r.approx != nil {
+			r.approx.hist = hist
+		}
+		return err
+	}
+	return nil
+}
+
+// Reopens the previous store after a failed swap of the storage directory
+// and reloads the board from it, the caller holds the lock. If even that
+// fails, the Ranker is left with a closed store, whose operations return
+// ErrStoreClosed.
+func (r *Ranker) reopen(dir string, cause error) error {
+	store, err := OpenPebbleStore(dir, r.pebbleOptions())
+	if err != nil {
+		closed := NewMemoryStore()
+		closed.Close()
+		r.store = closed
+		r.loaded = false
+		return errors.Join(cause, err)
+	}
+	r.store = store
+	return errors.Join(cause, r.reload(context.Background()))
+}
+
+// Rebuilds the in-memory board from the store, the caller holds the lock.
+func (r *Ranker) reload(ctx context.Context) error {
+	if r.approx != nil {
+		return r.loadApprox(ctx)
+	}
+	z, err := r.load(ctx)
+	if err != nil {
+		return err
+	}
+	r.zset = z
+	return nil
+}
+
+// Copies the regular files of src into a new directory dst.
+func copyDir(ctx context.Context, src, dst string) error {
+	if err := os.MkdirAll(dst, 0755); err != nil {
+		return err
+	}
+	entries, err := os.ReadDir(src)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if !entry.Type().IsRegular() {
+			continue
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := copyFile(filepath.Join(src, entry.Name()), filepath.Join(dst, entry.Name())); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Copies a single file and syncs it to disk.
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	if err := out.Sync(); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
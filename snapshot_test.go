@@ -0,0 +1,106 @@
+package ranker
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRanker_SnapshotRestore(t *testing.T) {
+	r := New(WithStorageDir(t.TempDir()))
+	assert.NoError(t, r.Start())
+	defer r.Close()
+
+	assert.NoError(t, r.Update("a", 1))
+	assert.NoError(t, r.Update("b", 2))
+
+	dir := filepath.Join(t.TempDir(), "snap")
+	assert.NoError(t, r.Snapshot(dir))
+	assert.Error(t, r.Snapshot(dir))
+
+	assert.NoError(t, r.Update("a", 5))
+	assert.NoError(t, r.Update("c", 3))
+	assert.NoError(t, r.Remove("b"))
+
+	assert.NoError(t, r.Restore(dir))
+	assert.Equal(t, 2, r.Count())
+	entries, err := r.Range(0, -1)
+	assert.NoError(t, err)
+	assert.Equal(t, "b", entries[0].Key)
+	assert.Equal(t, float64(1), entries[1].Score)
+	assert.NoError(t, r.Verify())
+
+	other := New(WithStorageDir(dir))
+	assert.NoError(t, other.Start())
+	assert.Equal(t, 2, other.Count())
+	other.Close()
+}
+
+func TestRanker_RestoreFailure(t *testing.T) {
+	parent := t.TempDir()
+	r := New(WithStorageDir(filepath.Join(parent, "rank")))
+	assert.NoError(t, r.Start())
+	defer r.Close()
+	assert.NoError(t, r.Update("a", 1))
+	assert.NoError(t, r.Update("b", 2))
+
+	// Neither an empty directory nor a broken one replaces the board.
+	empty := filepath.Join(t.TempDir(), "empty")
+	assert.NoError(t, os.Mkdir(empty, 0755))
+	assert.Error(t, r.Restore(empty))
+	broken := filepath.Join(t.TempDir(), "broken")
+	assert.NoError(t, os.Mkdir(broken, 0755))
+	assert.NoError(t, os.WriteFile(filepath.Join(broken, "CURRENT"), []byte("MANIFEST-999999\n"), 0644))
+	assert.Error(t, r.Restore(broken))
+	assert.Error(t, r.Restore(filepath.Join(t.TempDir(), "missing")))
+
+	assert.Equal(t, 2, r.Count())
+	assert.NoError(t, r.Update("c", 3))
+	assert.NoError(t, r.Verify())
+
+	// The staged copies are cleaned up.
+	entries, err := os.ReadDir(parent)
+	assert.NoError(t, err)
+	assert.Len(t, entries, 1)
+}
+
+// blockingCheckpointer holds Checkpoint until gate is closed, started is
+// closed once it was entered.
+type blockingCheckpointer struct {
+	*MemoryStore
+	started chan struct{}
+	gate    chan struct{}
+}
+
+func (s *blockingCheckpointer) Checkpoint(dir string) error {
+	close(s.started)
+	<-s.gate
+	return nil
+}
+
+func TestRanker_SnapshotWrites(t *testing.T) {
+	store := &blockingCheckpointer{MemoryStore: NewMemoryStore(),
+		started: make(chan struct{}), gate: make(chan struct{})}
+	r := New(WithStore(store))
+	assert.NoError(t, r.Start())
+	defer r.Close()
+
+	done := make(chan error)
+	go func() { done <- r.Snapshot(t.TempDir()) }()
+	<-store.started
+	// Writes are not held back by a running checkpoint.
+	assert.NoError(t, r.Update("a", 1))
+	assert.Equal(t, 1, r.Count())
+	close(store.gate)
+	assert.NoError(t, <-done)
+}
+
+func TestPebbleStore_CheckpointClosed(t *testing.T) {
+	store, err := OpenPebbleStore(t.TempDir(), nil)
+	assert.NoError(t, err)
+	assert.NoError(t, store.Close())
+	assert.ErrorIs(t, store.Checkpoint(filepath.Join(t.TempDir(), "cp")), ErrStoreClosed)
+	assert.ErrorIs(t, store.Close(), ErrStoreClosed)
+}
@@ -0,0 +1,182 @@
+package ranker
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+)
+
+// stagedStore is a Pebble store built next to the live one while a board is
+// replaced. Rows are committed every importBatchSize, so staging holds at
+// most one batch in memory whatever the size of the board.
+type stagedStore struct {
+	*PebbleStore
+	batch Batch
+	n     int
+}
+
+// Creates an empty staged store in a sibling of the live directory.
+func (r *Ranker) stage(live string) (*stagedStore, error) {
+	dir, err := os.MkdirTemp(filepath.Dir(live), filepath.Base(live)+".replace-")
+	if err != nil {
+		return nil, err
+	}
+	store, err := OpenPebbleStore(dir, r.pebbleOptions())
+	if err != nil {
+		os.RemoveAll(dir)
+		return nil, err
+	}
+	return &stagedStore{PebbleStore: store, batch: store.NewBatch()}, nil
+}
+
+// Writes a row, committing the batch once it is full.
+func (s *stagedStore) put(key string, score float64) error {
+	if err := s.batch.Set(unsafeStringToBytes(key), float64ToBytes(score)); err != nil {
+		return err
+	}
+	s.n++
+	if s.n%importBatchSize != 0 {
+		return nil
+	}
+	return s.flush()
+}
+
+// Commits the rows written since the last flush.
+func (s *stagedStore) flush() error {
+	err := s.batch.Commit()
+	s.batch.Close()
+	s.batch = s.PebbleStore.NewBatch()
+	return err
+}
+
+// Closes the store and removes its directory, unless it was switched to.
+func (s *stagedStore) discard() {
+	s.batch.Close()
+	s.Close()
+	os.RemoveAll(s.Dir())
+}
+
+// Replaces the board with z. With a Pebble store the new contents are staged
+// next to it without holding the lock and switched to afterwards, see
+// switchStaged; other stores are rewritten in a single batch, see swap.
+// Fails unless the board is ready, checked under the same lock.
+func (r *Ranker) replaceWith(ctx context.Context, z *ZSet) error {
+	r.mu.RLock()
+	ps, ok := r.store.(*PebbleStore)
+	r.mu.RUnlock()
+	if !ok {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		if err := r.checkReady(); err != nil {
+			return err
+		}
+		defer r.resetChanges()
+		return r.swap(z)
+	}
+
+	s, err := r.stage(ps.Dir())
+	if err != nil {
+		return err
+	}
+	defer s.discard()
+	n := 0
+	for x := z.zset.zsl.head.level[0].forward; x != nil; x = x.level[0].forward {
+		n++
+		if err := checkCanceled(ctx, n); err != nil {
+			return err
+		}
+		if err := s.put(x.member, x.score); err != nil {
+			return err
+		}
+	}
+	return r.switchStaged(ctx, s, z)
+}
+
+// Switches to a completely written staged store and installs its board: z
+// for exact ranks, while an approximate head is read back from the store
+// before the lock is taken. Writes made since staging began are dropped with
+// the old store. The WithMaxSize cap applies afterwards.
+func (r *Ranker) switchStaged(ctx context.Context, s *stagedStore, z *ZSet) error {
+	if err := s.flush(); err != nil {
+		return err
+	}
+	var hist *scoreHistogram
+	if r.approx != nil {
+		var err error
+		if z, hist, err = r.loadApproxFrom(ctx, s.PebbleStore); err != nil {
+			return err
+		}
+	}
+	if err := s.Close(); err != nil {
+		return err
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err := r.checkReady(); err != nil {
+		return err
+	}
+	// Followers resync instead of replaying the new board.
+	defer r.resetChanges()
+	ps, ok := r.store.(*PebbleStore)
+	if !ok {
+		return ErrStoreClosed
+	}
+	if err := r.switchStore(ps, s.Dir()); err != nil {
+		return err
+	}
+	r.zset = z
+	if r.approx != nil {
+		r.approx.hist = hist
+	}
+	return r.enforceMaxSize()
+}
+
+// Reads the head and the histogram of an approximate board from store,
+// leaving the live board alone.
+func (r *Ranker) loadApproxFrom(ctx context.Context, store Store) (*ZSet, *scoreHistogram, error) {
+	r.mu.RLock()
+	precision := r.approx.hist.precision
+	r.mu.RUnlock()
+	scratch := &Ranker{
+		store:  store,
+		approx: &approxRanks{headSize: r.approx.headSize, hist: newScoreHistogram(precision)},
+	}
+	if err := scratch.loadApprox(ctx); err != nil {
+		return nil, nil, err
+	}
+	return scratch.zset, scratch.approx.hist, nil
+}
+
+// Renames a staged Pebble directory over the one of the live store ps and
+// opens it, the caller holds the lock. Pebble keeps using the path it was
+// opened with, so the live store is closed first. If the switch fails the
+// live store is reopened and the board reloaded from it, see reopen.
+func (r *Ranker) switchStore(ps *PebbleStore, staged string) error {
+	live := ps.Dir()
+	if err := ps.Close(); err != nil && !errors.Is(err, ErrStoreClosed) {
+		r.logger.Warn("failed to close store", "id", r.ID, "err", err)
+	}
+	r.store = nil
+	backup := staged + ".old"
+	if err := os.Rename(live, backup); err != nil {
+		return r.reopen(live, err)
+	}
+	if err := os.Rename(staged, live); err != nil {
+		os.Rename(backup, live)
+		return r.reopen(live, err)
+	}
+	store, err := OpenPebbleStore(live, r.pebbleOptions())
+	if err != nil {
+		os.Rename(live, staged)
+		os.Rename(backup, live)
+		return r.reopen(live, err)
+	}
+	r.store = store
+	os.RemoveAll(backup)
+	return nil
+}
@@ -0,0 +1,116 @@
+package ranker
+
+import (
+	"errors"
+)
+
+var (
+	ErrNotSupported = errors.New("not supported by this store")
+	ErrStoreClosed  = errors.New("store is closed")
+)
+
+// Store persists player scores for a Ranker. Keys are player IDs and
+// values are encoded scores; the Ranker keeps the in-memory ZSet in step
+// with the store, so a store only needs to be a durable key-value map.
+//
+// Implementations must copy keys and values passed in, since the Ranker
+// may reuse their memory after the call returns. A Store is used while the
+// Ranker lock is held, except for Get and Iterate which may also run from
+// the background loader concurrently with writes.
+type Store interface {
+	// Returns a copy of the value stored under key, or ErrKeyNotExist.
+	Get(key []byte) ([]byte, error)
+	// Stores value under key.
+	Set(key, value []byte) error
+	// Removes key, missing keys are not an error.
+	Delete(key []byte) error
+	// Starts a batch of writes that is applied atomically by Commit.
+	NewBatch() Batch
+	// Calls fn for every key in [lower, upper) in ascending key order, nil
+	// bounds are unbounded. key and value are only valid during the call.
+	Iterate(lower, upper []byte, fn func(key, value []byte) error) error
+	// Releases the store.
+	Close() error
+}
+
+// Batch collects writes that are applied together.
+type Batch interface {
+	Set(key, value []byte) error
+	Delete(key []byte) error
+	// Applies the batch, it can't be reused afterwards.
+	Commit() error
+	// Releases the batch, committed or not.
+	Close() error
+}
+
+// KeyRange is a half-open span of store keys, nil bounds are unbounded.
+type KeyRange struct {
+	Lower, Upper []byte
+}
+
+// Splitter is implemented by stores that can cut their keyspace into ranges
+// of similar size, letting Start read them in parallel.
+type Splitter interface {
+	Split(n int) ([]KeyRange, error)
+}
+
+// Truncater is implemented by stores that can drop every key at once.
+type Truncater interface {
+	Truncate() error
+}
+
+// Checkpointer is implemented by stores that can write a consistent copy of
+// themselves to a new directory, used by Ranker.Snapshot.
+type Checkpointer interface {
+	Checkpoint(dir string) error
+}
+
+// Incrementer is implemented by stores that record increments as such
+// instead of the resulting value. Values hold scores as written by the
+// Ranker: a float64 in 8 little-endian bytes, missing keys count as 0.
+type Incrementer interface {
+	Incr(key []byte, delta float64) (float64, error)
+}
+
+// Sizer is implemented by stores that know how many bytes they use on disk.
+type Sizer interface {
+	DiskUsage() uint64
+}
+
+// Configures the store backing the Ranker instead of the default Pebble
+// store in StorageDir. The Ranker takes ownership and closes it on Close.
+func WithStore(store Store) Option {
+	return func(r *Ranker) {
+		r.store = store
+	}
+}
+
+// Removes every key from the store, in batches when it can't truncate.
+func truncateStore(s Store) error {
+	if t, ok := s.(Truncater); ok {
+		return t.Truncate()
+	}
+
+	var keys [][]byte
+	err := s.Iterate(nil, nil, func(key, _ []byte) error {
+		keys = append(keys, append([]byte(nil), key...))
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for len(keys) > 0 {
+		n := min(len(keys), importBatchSize)
+		batch := s.NewBatch()
+		for _, key := range keys[:n] {
+			batch.Delete(key)
+		}
+		err := batch.Commit()
+		batch.Close()
+		if err != nil {
+			return err
+		}
+		keys = keys[n:]
+	}
+	return nil
+}
@@ -0,0 +1,293 @@
+package ranker
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"log/slog"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func testStores(t *testing.T) map[string]func() Store {
+	return map[string]func() Store{
+		"memory": func() Store { return NewMemoryStore() },
+		"pebble": func() Store {
+			s, err := OpenPebbleStore(t.TempDir(), nil)
+			assert.NoError(t, err)
+			return s
+		},
+		"aof": func() Store {
+			s, err := OpenAOFStore(filepath.Join(t.TempDir(), "ranker.aof"))
+			assert.NoError(t, err)
+			return s
+		},
+	}
+}
+
+func collect(t *testing.T, s Store, lower, upper []byte) map[string]string {
+	got := map[string]string{}
+	var last string
+	assert.NoError(t, s.Iterate(lower, upper, func(key, value []byte) error {
+		assert.Greater(t, string(key), last)
+		last = string(key)
+		got[string(key)] = string(value)
+		return nil
+	}))
+	return got
+}
+
+func TestStore(t *testing.T) {
+	for name, open := range testStores(t) {
+		t.Run(name, func(t *testing.T) {
+			s := open()
+			defer s.Close()
+
+			assert.NoError(t, s.Set([]byte("b"), []byte("2")))
+			assert.NoError(t, s.Set([]byte("a"), []byte("1")))
+			assert.NoError(t, s.Set([]byte("c"), []byte("3")))
+			value, err := s.Get([]byte("a"))
+			assert.NoError(t, err)
+			assert.Equal(t, "1", string(value))
+			_, err = s.Get([]byte("x"))
+			assert.ErrorIs(t, err, ErrKeyNotExist)
+
+			assert.NoError(t, s.Delete([]byte("c")))
+			assert.NoError(t, s.Delete([]byte("missing")))
+
+			batch := s.NewBatch()
+			batch.Set([]byte("d"), []byte("4"))
+			batch.Delete([]byte("a"))
+			assert.Equal(t, map[string]string{"a": "1", "b": "2"}, collect(t, s, nil, nil))
+			assert.NoError(t, batch.Commit())
+			batch.Close()
+
+			assert.Equal(t, map[string]string{"b": "2", "d": "4"}, collect(t, s, nil, nil))
+			assert.Equal(t, map[string]string{"b": "2"}, collect(t, s, []byte("b"), []byte("c")))
+
+			// Keys and values are copied, the caller may reuse their memory.
+			key, buf := []byte("e"), []byte("5")
+			assert.NoError(t, s.Set(key, buf))
+			key[0], buf[0] = 'f', '6'
+			assert.Equal(t, map[string]string{"b": "2", "d": "4", "e": "5"}, collect(t, s, nil, nil))
+
+			assert.NoError(t, truncateStore(s))
+			assert.Empty(t, collect(t, s, nil, nil))
+		})
+	}
+}
+
+func TestAOFStore_Reopen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ranker.aof")
+	s, err := OpenAOFStore(path)
+	assert.NoError(t, err)
+	assert.NoError(t, s.Set([]byte("a"), []byte("1")))
+	assert.NoError(t, s.Set([]byte("b"), []byte("2")))
+	assert.NoError(t, s.Delete([]byte("a")))
+	assert.NoError(t, s.Close())
+
+	// Simulate a write torn by a crash.
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0644)
+	assert.NoError(t, err)
+	f.Write(appendAOFRecord(nil, aofOpSet, []byte("c"), []byte("3"))[:9])
+	f.Close()
+
+	s, err = OpenAOFStore(path)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"b": "2"}, collect(t, s, nil, nil))
+	assert.NoError(t, s.Set([]byte("c"), []byte("3")))
+	assert.NoError(t, s.Close())
+
+	s, err = OpenAOFStore(path)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"b": "2", "c": "3"}, collect(t, s, nil, nil))
+	assert.NoError(t, s.Close())
+}
+
+func TestAOFStore_Corrupt(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ranker.aof")
+	s, err := OpenAOFStore(path)
+	assert.NoError(t, err)
+	for i := 0; i < 100; i++ {
+		assert.NoError(t, s.Set([]byte(fmt.Sprintf("k%02d", i)), []byte("v")))
+	}
+	assert.NoError(t, s.Close())
+	data, err := os.ReadFile(path)
+	assert.NoError(t, err)
+	record := len(appendAOFRecord(nil, aofOpSet, []byte("k00"), []byte("v")))
+
+	// A damaged record in the middle fails the open and keeps the file.
+	corrupt := bytes.Clone(data)
+	corrupt[10*record+9] ^= 0xff
+	assert.NoError(t, os.WriteFile(path, corrupt, 0644))
+	_, err = OpenAOFStore(path)
+	assert.ErrorIs(t, err, errAOFChecksum)
+	assert.ErrorContains(t, err, fmt.Sprintf("offset %d", 10*record))
+	info, err := os.Stat(path)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(len(data)), info.Size())
+
+	// A length running past the end is a torn record and allocates nothing.
+	torn := bytes.Clone(data)
+	binary.LittleEndian.PutUint32(torn[99*record+4:], math.MaxUint32)
+	assert.NoError(t, os.WriteFile(path, torn, 0644))
+	s, err = OpenAOFStore(path)
+	assert.NoError(t, err)
+	assert.Len(t, collect(t, s, nil, nil), 99)
+	assert.NoError(t, s.Close())
+
+	// So is a damaged last record.
+	corrupt = bytes.Clone(data)
+	corrupt[len(corrupt)-1] ^= 0xff
+	assert.NoError(t, os.WriteFile(path, corrupt, 0644))
+	s, err = OpenAOFStore(path)
+	assert.NoError(t, err)
+	assert.Len(t, collect(t, s, nil, nil), 99)
+	assert.NoError(t, s.Close())
+}
+
+func TestRanker_WithStore(t *testing.T) {
+	for name, open := range testStores(t) {
+		t.Run(name, func(t *testing.T) {
+			r := New(WithStore(open()))
+			assert.NoError(t, r.Start())
+			defer r.Close()
+
+			assert.NoError(t, r.Update("a", 1))
+			assert.NoError(t, r.Update("b", 2))
+			_, err := r.IncrBy("a", 5)
+			assert.NoError(t, err)
+			assert.NoError(t, r.Remove("b"))
+			entry, err := r.Rank("a")
+			assert.NoError(t, err)
+			assert.Equal(t, float64(6), entry.Score)
+			assert.NoError(t, r.Verify())
+		})
+	}
+}
+
+func TestAOFStore_Incr(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ranker.aof")
+	s, err := OpenAOFStore(path, WithFsync(FsyncAlways))
+	assert.NoError(t, err)
+	score, err := s.Incr([]byte("a"), 2)
+	assert.NoError(t, err)
+	assert.Equal(t, float64(2), score)
+	score, err = s.Incr([]byte("a"), 3.5)
+	assert.NoError(t, err)
+	assert.Equal(t, 5.5, score)
+	assert.NoError(t, s.Close())
+
+	s, err = OpenAOFStore(path)
+	assert.NoError(t, err)
+	defer s.Close()
+	value, err := s.Get([]byte("a"))
+	assert.NoError(t, err)
+	assert.Equal(t, 5.5, bytesToFloat64(value))
+}
+
+func TestAOFStore_Rewrite(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ranker.aof")
+	s, err := OpenAOFStore(path, WithFsync(FsyncNo))
+	assert.NoError(t, err)
+	for i := 0; i < 1000; i++ {
+		_, err := s.Incr([]byte{byte('a' + i%3)}, 1)
+		assert.NoError(t, err)
+	}
+	assert.NoError(t, s.Delete([]byte("c")))
+	before := s.DiskUsage()
+
+	assert.NoError(t, s.Rewrite())
+	assert.Less(t, s.DiskUsage(), before)
+	assert.NoError(t, s.Set([]byte("d"), float64ToBytes(7)))
+	assert.NoError(t, s.Close())
+
+	s, err = OpenAOFStore(path)
+	assert.NoError(t, err)
+	defer s.Close()
+	assert.Equal(t, map[string]string{
+		"a": string(float64ToBytes(334)),
+		"b": string(float64ToBytes(333)),
+		"d": string(float64ToBytes(7)),
+	}, collect(t, s, nil, nil))
+}
+
+func TestAOFStore_AutoRewrite(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ranker.aof")
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewJSONHandler(&buf, nil))
+	s, err := OpenAOFStore(path, WithRewriteThreshold(1024, 100), WithAOFLogger(logger))
+	assert.NoError(t, err)
+	for i := 0; i < 1000; i++ {
+		_, err := s.Incr([]byte("a"), 1)
+		assert.NoError(t, err)
+	}
+	assert.NoError(t, s.Close())
+
+	// Close waits for running rewrites, so their events are in.
+	records := logRecords(t, &buf)
+	assert.NotNil(t, findRecord(records, "aof rewritten"))
+	assert.Nil(t, findRecord(records, "aof rewrite failed"))
+
+	s, err = OpenAOFStore(path)
+	assert.NoError(t, err)
+	defer s.Close()
+	value, err := s.Get([]byte("a"))
+	assert.NoError(t, err)
+	assert.Equal(t, float64(1000), bytesToFloat64(value))
+
+	// Rewriting leaves one set record per key, compared with the 1000
+	// increment records appended.
+	assert.NoError(t, s.Rewrite())
+	record := len(appendAOFRecord(nil, aofOpSet, []byte("a"), float64ToBytes(0)))
+	assert.Equal(t, uint64(record), s.DiskUsage())
+}
+
+func TestAOFStore_AutoRewriteFailure(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ranker.aof")
+	// A directory in the way of the rewritten file makes every rewrite fail.
+	assert.NoError(t, os.Mkdir(path+".rewrite", 0755))
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewJSONHandler(&buf, nil))
+	s, err := OpenAOFStore(path, WithRewriteThreshold(1024, 100), WithAOFLogger(logger))
+	assert.NoError(t, err)
+	for i := 0; i < 1000; i++ {
+		_, err := s.Incr([]byte("a"), 1)
+		assert.NoError(t, err)
+	}
+	assert.NoError(t, s.Close())
+
+	// Failures are logged, and retried only once the file grew again.
+	failed := 0
+	for _, record := range logRecords(t, &buf) {
+		if record["msg"] == "aof rewrite failed" {
+			failed++
+		}
+	}
+	assert.Positive(t, failed)
+	assert.Less(t, failed, 10)
+}
+
+func TestRanker_WithAOF(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ranker.aof")
+	r := New(WithAOF(path))
+	assert.NoError(t, r.Start())
+	assert.NoError(t, r.Update("a", 1))
+	_, err := r.IncrBy("a", 2)
+	assert.NoError(t, err)
+	assert.NoError(t, r.Update("b", 2))
+	r.Close()
+
+	r = New(WithAOF(path))
+	assert.NoError(t, r.Start())
+	defer r.Close()
+	entry, err := r.Rank("a")
+	assert.NoError(t, err)
+	assert.Equal(t, float64(3), entry.Score)
+	assert.Equal(t, 0, entry.Rank)
+	assert.Equal(t, 2, r.Count())
+}
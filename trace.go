@@ -0,0 +1,117 @@
+package ranker
+
+import (
+	"context"
+	"log/slog"
+	"time"
+)
+
+// Operation names used in spans, metrics, logs and the slowlog.
+const (
+	opUpdate       = "update"
+	opIncrBy       = "incr_by"
+	opRemove       = "remove"
+	opScore        = "score"
+	opRank         = "rank"
+	opRange        = "range"
+	opCount        = "count"
+	opCountByScore = "count_by_score"
+	opCountAbove   = "count_above"
+	opImport       = "import"
+	opExport       = "export"
+	opTrim         = "trim"
+	opStore        = "store"
+	opUnionStore   = "union_store"
+	opInterStore   = "inter_store"
+	opDiffStore    = "diff_store"
+	opStats        = "stats"
+	opVerify       = "verify"
+	opCheck        = "check"
+	opSnapshot     = "snapshot"
+	opRestore      = "restore"
+)
+
+// Tracer starts a span around every Ranker operation, see WithTracer. It
+// follows the shape of an OpenTelemetry tracer, so adapting one takes a few
+// lines.
+type Tracer interface {
+	// Starts a span named name as a child of any span in ctx, returning a
+	// context holding the new span.
+	Start(ctx context.Context, name string, attrs ...slog.Attr) (context.Context, Span)
+}
+
+// Span is an operation being traced.
+type Span interface {
+	// Ends the span, err is the error the operation returned, if any.
+	End(err error)
+}
+
+// Configures a tracer receiving a span for every operation, named after the
+// operation with a "ranker." prefix. Spans nest under the span in the
+// context given to the Context variants of the methods.
+func WithTracer(tracer Tracer) Option {
+	return func(r *Ranker) {
+		r.tracer = tracer
+	}
+}
+
+// operation is a Ranker method call being measured, see begin.
+type operation struct {
+	r     *Ranker
+	ctx   context.Context
+	name  string
+	attrs []slog.Attr
+	start time.Time
+	span  Span
+}
+
+// Starts measuring an operation, attrs describe its arguments. The caller
+// defers end.
+func (r *Ranker) begin(ctx context.Context, name string, attrs ...slog.Attr) operation {
+	op := operation{r: r, ctx: ctx, name: name, attrs: attrs, start: time.Now()}
+	if r.tracer != nil {
+		op.ctx, op.span = r.tracer.Start(ctx, "ranker."+name,
+			append([]slog.Attr{slog.String("ranker.id", r.ID)}, attrs...)...)
+	}
+	return op
+}
+
+// Finishes an operation that returned *err, or nil for operations that
+// can't fail. Ends the span, updates the metrics, logs store failures and
+// records slow operations in the log and the slowlog.
+func (op operation) end(errp *error) {
+	var err error
+	if errp != nil {
+		err = *errp
+	}
+	r := op.r
+	elapsed := time.Since(op.start)
+	if op.span != nil {
+		op.span.End(err)
+	}
+	r.metrics.observe(op.name, elapsed, err)
+
+	if err != nil && !isExpected(err) {
+		r.logger.LogAttrs(op.ctx, slog.LevelError, "operation failed",
+			append([]slog.Attr{slog.String("op", op.name), slog.Any("err", err)}, op.attrs...)...)
+	}
+	if r.slowThreshold <= 0 || elapsed < r.slowThreshold {
+		return
+	}
+	r.logger.LogAttrs(op.ctx, slog.LevelWarn, "slow operation",
+		append([]slog.Attr{slog.String("op", op.name), slog.Duration("duration", elapsed)}, op.attrs...)...)
+
+	entry := SlowlogEntry{
+		Time:     op.start,
+		Duration: elapsed,
+		Op:       op.name,
+		Args:     make([]string, len(op.attrs)),
+	}
+	for i, attr := range op.attrs {
+		entry.Args[i] = attr.Value.String()
+	}
+	if err != nil {
+		entry.Err = err.Error()
+	}
+	r.slowlog.add(entry)
+}
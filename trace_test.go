@@ -0,0 +1,72 @@
+package ranker
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type spanKey struct{}
+
+// testTracer records finished spans and the name of their parent.
+type testTracer struct {
+	mu    sync.Mutex
+	spans []*testSpan
+}
+
+type testSpan struct {
+	tracer *testTracer
+	name   string
+	parent string
+	attrs  []slog.Attr
+	err    error
+}
+
+func (t *testTracer) Start(ctx context.Context, name string, attrs ...slog.Attr) (context.Context, Span) {
+	span := &testSpan{tracer: t, name: name, attrs: attrs}
+	if parent, ok := ctx.Value(spanKey{}).(*testSpan); ok {
+		span.parent = parent.name
+	}
+	return context.WithValue(ctx, spanKey{}, span), span
+}
+
+func (s *testSpan) End(err error) {
+	s.err = err
+	s.tracer.mu.Lock()
+	s.tracer.spans = append(s.tracer.spans, s)
+	s.tracer.mu.Unlock()
+}
+
+func TestRanker_WithTracer(t *testing.T) {
+	tracer := &testTracer{}
+	r := New(WithID("board"), WithStore(NewMemoryStore()), WithTracer(tracer))
+	assert.NoError(t, r.Start())
+	defer r.Close()
+
+	ctx, parent := tracer.Start(context.Background(), "request")
+	assert.NoError(t, r.UpdateContext(ctx, "a", 1))
+	_, err := r.RankContext(ctx, "missing")
+	assert.ErrorIs(t, err, ErrKeyNotExist)
+	_, err = r.Range(0, 9)
+	assert.NoError(t, err)
+	parent.End(nil)
+
+	spans := tracer.spans
+	assert.Len(t, spans, 4)
+	assert.Equal(t, "ranker.update", spans[0].name)
+	assert.Equal(t, "request", spans[0].parent)
+	assert.Equal(t, []slog.Attr{
+		slog.String("ranker.id", "board"),
+		slog.String("player", "a"),
+		slog.Float64("score", 1),
+	}, spans[0].attrs)
+	assert.NoError(t, spans[0].err)
+
+	assert.Equal(t, "ranker.rank", spans[1].name)
+	assert.ErrorIs(t, spans[1].err, ErrKeyNotExist)
+	assert.Equal(t, "ranker.range", spans[2].name)
+	assert.Empty(t, spans[2].parent)
+}
@@ -0,0 +1,96 @@
+package ranker
+
+import (
+	"context"
+	"log/slog"
+)
+
+// Configures a capped leaderboard keeping only the best n players: whenever
+// a write or an import grows the board past n, the lowest ranked players
+// are removed from the store and the in-memory set. A write whose score
+// ranks below the top n is therefore dropped right away. Start trims a
+// board loaded with more players. Values below 1 disable the cap.
+//
+// Doesn't combine with WithApproximateRanks, which only keeps the head in
+// memory.
+func WithMaxSize(n int) Option {
+	return func(r *Ranker) {
+		r.maxSize = max(n, 0)
+	}
+}
+
+// Removes the lowest ranked players until at most maxSize remain, and
+// returns how many were removed.
+func (r *Ranker) Trim(maxSize int) (int, error) {
+	return r.TrimContext(context.Background(), maxSize)
+}
+
+// Like Trim, with ctx for tracing and cancellation.
+func (r *Ranker) TrimContext(ctx context.Context, maxSize int) (_ int, err error) {
+	op := r.begin(ctx, opTrim, slog.Int("max_size", maxSize))
+	defer op.end(&err)
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	if maxSize < 0 {
+		return 0, ErrInvalidParams
+	}
+	if r.approx != nil {
+		return 0, ErrNotSupported
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err := r.checkReady(); err != nil {
+		return 0, err
+	}
+	return r.trim(maxSize)
+}
+
+// Applies the WithMaxSize cap, the caller holds the write lock.
+func (r *Ranker) enforceMaxSize() error {
+	if r.maxSize == 0 || r.warming || r.zset.ZCard() <= r.maxSize {
+		return nil
+	}
+	_, err := r.trim(r.maxSize)
+	return err
+}
+
+// Removes the lowest ranked players beyond maxSize, a batch at a time:
+// each batch is deleted from the store and then unlinked from the skiplist
+// in one pass, so a failed commit leaves both in step. The caller holds the
+// write lock.
+func (r *Ranker) trim(maxSize int) (int, error) {
+	removed := 0
+	for {
+		n := min(r.zset.ZCard()-maxSize, importBatchSize)
+		if n <= 0 {
+			return removed, nil
+		}
+
+		members := make([]string, 0, n)
+		for x := r.zset.zset.zsl.head.level[0].forward; len(members) < n; x = x.level[0].forward {
+			members = append(members, x.member)
+		}
+		if err := r.deleteMembers(members); err != nil {
+			return removed, err
+		}
+
+		r.zset.ZRemRangeByRank(0, n-1)
+		for _, member := range members {
+			r.logChange(ChangeRemove, member, 0)
+		}
+		removed += n
+	}
+}
+
+// Deletes members from the store in one batch.
+func (r *Ranker) deleteMembers(members []string) error {
+	batch := r.store.NewBatch()
+	defer batch.Close()
+	for _, member := range members {
+		if err := batch.Delete(unsafeStringToBytes(member)); err != nil {
+			return err
+		}
+	}
+	return batch.Commit()
+}
@@ -0,0 +1,105 @@
+package ranker
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRanker_Trim(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "rank")
+	r := New(WithStorageDir(dir))
+	assert.NoError(t, r.Start())
+	n := importBatchSize + 500
+	_, err := r.Import(strings.NewReader(csvRows(n)), FormatCSV, ImportReplace)
+	assert.NoError(t, err)
+
+	removed, err := r.Trim(100)
+	assert.NoError(t, err)
+	assert.Equal(t, n-100, removed)
+	assert.Equal(t, 100, r.Count())
+	entries, err := r.Range(0, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, fmt.Sprintf("p%d", n-1), entries[0].Key)
+	assert.NoError(t, r.Verify())
+
+	removed, err = r.Trim(1000)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, removed)
+	_, err = r.Trim(-1)
+	assert.ErrorIs(t, err, ErrInvalidParams)
+	r.Close()
+
+	// The pruned players are gone from the store too.
+	r = New(WithStorageDir(dir))
+	assert.NoError(t, r.Start())
+	defer r.Close()
+	assert.Equal(t, 100, r.Count())
+	_, err = r.Score("p0")
+	assert.ErrorIs(t, err, ErrKeyNotExist)
+}
+
+func TestRanker_WithMaxSize(t *testing.T) {
+	store := NewMemoryStore()
+	r := New(WithStore(store), WithMaxSize(3))
+	assert.NoError(t, r.Start())
+
+	for i, player := range []string{"a", "b", "c", "d"} {
+		assert.NoError(t, r.Update(player, float64(i)))
+	}
+	assert.Equal(t, 3, r.Count())
+	_, err := r.Score("a")
+	assert.ErrorIs(t, err, ErrKeyNotExist)
+
+	// A score below the cap is dropped right away.
+	assert.NoError(t, r.Update("e", -1))
+	_, err = r.Score("e")
+	assert.ErrorIs(t, err, ErrKeyNotExist)
+
+	_, err = r.IncrBy("f", 10)
+	assert.NoError(t, err)
+	_, err = r.Score("b")
+	assert.ErrorIs(t, err, ErrKeyNotExist)
+
+	_, err = r.Import(strings.NewReader(csvRows(10)), FormatCSV, ImportMergeMax)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, r.Count())
+	entries, err := r.Range(0, -1)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"f", "p9", "p8"}, []string{entries[0].Key, entries[1].Key, entries[2].Key})
+	assert.NoError(t, r.Verify())
+	r.Close()
+
+	// Start trims a board loaded with more players than the cap.
+	store = NewMemoryStore()
+	for i := 0; i < 10; i++ {
+		assert.NoError(t, store.Set([]byte(fmt.Sprintf("p%d", i)), float64ToBytes(float64(i))))
+	}
+	r = New(WithStore(store), WithMaxSize(4))
+	assert.NoError(t, r.Start())
+	defer r.Close()
+	assert.Equal(t, 4, r.Count())
+	assert.NoError(t, r.Verify())
+
+	assert.ErrorIs(t, New(WithStore(NewMemoryStore()), WithMaxSize(4), WithApproximateRanks(10, 8)).Start(), ErrInvalidParams)
+}
+
+func TestRanker_TrimFailure(t *testing.T) {
+	store := &failingStore{MemoryStore: NewMemoryStore()}
+	r := New(WithStore(store))
+	assert.NoError(t, r.Start())
+	defer r.Close()
+	for i := 0; i < 5; i++ {
+		assert.NoError(t, r.Update(fmt.Sprintf("p%d", i), float64(i)))
+	}
+
+	store.broken = true
+	_, err := r.Trim(2)
+	assert.ErrorContains(t, err, "delete failed")
+	store.broken = false
+	assert.Equal(t, 5, r.Count())
+	assert.NoError(t, r.Verify())
+}
@@ -0,0 +1,223 @@
+package ranker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+)
+
+var (
+	ErrInconsistent = errors.New("ranker is inconsistent")
+)
+
+// DiscrepancyKind classifies a disagreement between the store and the ZSet.
+type DiscrepancyKind int
+
+const (
+	MissingInMemory DiscrepancyKind = iota // Stored but not ranked
+	MissingInStore                         // Ranked but not stored
+	ScoreMismatch                          // Stored and ranked with different scores
+)
+
+// String returns the discrepancy kind name.
+func (k DiscrepancyKind) String() string {
+	switch k {
+	case MissingInMemory:
+		return "missing in memory"
+	case MissingInStore:
+		return "missing in store"
+	case ScoreMismatch:
+		return "score mismatch"
+	}
+	return "unknown"
+}
+
+// Discrepancy is a single player whose stored and ranked state disagree.
+type Discrepancy struct {
+	Kind   DiscrepancyKind `json:"kind"`
+	Key    string          `json:"key"`
+	Stored float64         `json:"stored"` // Score in the store, 0 when missing
+	Ranked float64         `json:"ranked"` // Score in the ZSet, 0 when missing
+}
+
+// String describes the discrepancy.
+func (d Discrepancy) String() string {
+	switch d.Kind {
+	case MissingInMemory:
+		return fmt.Sprintf("player %q is stored with score %v but not ranked", d.Key, d.Stored)
+	case MissingInStore:
+		return fmt.Sprintf("player %q is ranked with score %v but not stored", d.Key, d.Ranked)
+	}
+	return fmt.Sprintf("player %q is stored with score %v but ranked with %v", d.Key, d.Stored, d.Ranked)
+}
+
+// Report is the outcome of a consistency check.
+type Report struct {
+	Stored        int           `json:"stored"`              // Records found in the store
+	Ranked        int           `json:"ranked"`              // Members found in the ZSet
+	Structure     string        `json:"structure,omitempty"` // Broken skiplist invariant, if any
+	Discrepancies []Discrepancy `json:"discrepancies,omitempty"`
+	Repaired      bool          `json:"repaired"` // Whether the ZSet was fixed up from the store
+}
+
+// Reports whether no problem was found.
+func (rp *Report) OK() bool {
+	return rp.Structure == "" && len(rp.Discrepancies) == 0
+}
+
+// Checks the skiplist invariants and cross-checks every stored record
+// against the in-memory set, returning ErrInconsistent on the first problem.
+func (r *Ranker) Verify() error {
+	return r.VerifyContext(context.Background())
+}
+
+// Like Verify, with ctx for tracing and cancellation.
+func (r *Ranker) VerifyContext(ctx context.Context) (err error) {
+	op := r.begin(ctx, opVerify)
+	defer op.end(&err)
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if err := r.checkReady(); err != nil {
+		return err
+	}
+
+	report, err := r.check(ctx)
+	if err != nil {
+		return err
+	}
+	if report.Structure != "" {
+		return fmt.Errorf("%w: %s", ErrInconsistent, report.Structure)
+	}
+	if len(report.Discrepancies) > 0 {
+		return fmt.Errorf("%w: %s", ErrInconsistent, report.Discrepancies[0])
+	}
+	return nil
+}
+
+// Runs the same checks as Verify and reports every problem found. With
+// repair set, the store is treated as the source of truth and the in-memory
+// set is fixed up to match it, or rebuilt when its structure is broken.
+// Without persistence or with approximate ranks only the structure is
+// checked, and a broken set is rebuilt from its member index.
+func (r *Ranker) Check(repair bool) (*Report, error) {
+	return r.CheckContext(context.Background(), repair)
+}
+
+// Like Check, with ctx for tracing and cancellation.
+func (r *Ranker) CheckContext(ctx context.Context, repair bool) (_ *Report, err error) {
+	op := r.begin(ctx, opCheck, slog.Bool("repair", repair))
+	defer op.end(&err)
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if !repair {
+		r.mu.RLock()
+		defer r.mu.RUnlock()
+	} else {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+	}
+	if err := r.checkReady(); err != nil {
+		return nil, err
+	}
+
+	report, err := r.check(ctx)
+	if err != nil || !repair || report.OK() {
+		return report, err
+	}
+
+	if report.Structure != "" && (r.ephemeral || r.approx != nil) {
+		r.zset = r.rebuild()
+	} else if report.Structure != "" {
+		z, err := r.loadData(ctx)
+		if err != nil {
+			return report, err
+		}
+		r.zset = z
+	} else {
+		for _, d := range report.Discrepancies {
+			if d.Kind == MissingInStore {
+				r.zset.ZRem(d.Key)
+			} else {
+				r.zset.ZAdd(d.Stored, d.Key)
+			}
+		}
+	}
+	r.resetChanges()
+	report.Repaired = true
+	return report, nil
+}
+
+// Collects the report, the caller holds the lock.
+func (r *Ranker) check(ctx context.Context) (*Report, error) {
+	report := &Report{Ranked: r.zset.ZCard()}
+	if err := r.zset.Verify(); err != nil {
+		// Lookups can't be trusted on a broken list, so stop here.
+		report.Structure = err.Error()
+		return report, nil
+	}
+	if r.ephemeral || r.approx != nil {
+		// There is no store to compare against, or the set only holds a
+		// part of it.
+		return report, nil
+	}
+
+	err := r.store.Iterate(nil, nil, func(key, value []byte) error {
+		report.Stored++
+		if err := checkCanceled(ctx, report.Stored); err != nil {
+			return err
+		}
+		stored := bytesToFloat64(value)
+		score, err := r.zset.ZScore(unsafeBytesToString(key))
+		if err != nil {
+			report.Discrepancies = append(report.Discrepancies, Discrepancy{
+				Kind: MissingInMemory, Key: string(key), Stored: stored,
+			})
+		} else if score != stored {
+			report.Discrepancies = append(report.Discrepancies, Discrepancy{
+				Kind: ScoreMismatch, Key: string(key), Stored: stored, Ranked: score,
+			})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Every stored record that is also ranked was matched above, so the
+	// counts only differ when some members are ranked without being stored.
+	matched := report.Stored
+	for _, d := range report.Discrepancies {
+		if d.Kind == MissingInMemory {
+			matched--
+		}
+	}
+	if matched == report.Ranked {
+		return report, nil
+	}
+	for x := r.zset.zset.zsl.head.level[0].forward; x != nil; x = x.level[0].forward {
+		_, err := r.store.Get(unsafeStringToBytes(x.member))
+		if err == ErrKeyNotExist {
+			report.Discrepancies = append(report.Discrepancies, Discrepancy{
+				Kind: MissingInStore, Key: x.member, Ranked: x.score,
+			})
+		} else if err != nil {
+			return nil, err
+		}
+	}
+	return report, nil
+}
+
+// Rebuilds the set from its dict, which keeps the score of every member
+// even when the skiplist links are broken.
+func (r *Ranker) rebuild() *ZSet {
+	z := NewZSet()
+	for member, node := range r.zset.zset.dict {
+		z.ZAdd(node.score, member)
+	}
+	return z
+}
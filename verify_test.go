@@ -0,0 +1,60 @@
+package ranker
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRanker_Check(t *testing.T) {
+	r := New(WithStore(NewMemoryStore()))
+	assert.NoError(t, r.Start())
+	defer r.Close()
+
+	assert.NoError(t, r.Update("a", 1))
+	assert.NoError(t, r.Update("b", 2))
+	assert.NoError(t, r.Update("c", 3))
+	report, err := r.Check(false)
+	assert.NoError(t, err)
+	assert.True(t, report.OK())
+
+	// Diverge the two sides behind the Ranker's back.
+	assert.NoError(t, r.store.Set([]byte("d"), float64ToBytes(4)))
+	assert.NoError(t, r.store.Set([]byte("a"), float64ToBytes(10)))
+	r.zset.ZAdd(5, "e")
+
+	assert.ErrorIs(t, r.Verify(), ErrInconsistent)
+	report, err = r.Check(false)
+	assert.NoError(t, err)
+	assert.Equal(t, 4, report.Stored)
+	assert.Equal(t, 4, report.Ranked)
+	assert.ElementsMatch(t, []Discrepancy{
+		{Kind: ScoreMismatch, Key: "a", Stored: 10, Ranked: 1},
+		{Kind: MissingInMemory, Key: "d", Stored: 4},
+		{Kind: MissingInStore, Key: "e", Ranked: 5},
+	}, report.Discrepancies)
+
+	report, err = r.Check(true)
+	assert.NoError(t, err)
+	assert.True(t, report.Repaired)
+	assert.NoError(t, r.Verify())
+	entry, err := r.Rank("a")
+	assert.NoError(t, err)
+	assert.Equal(t, 0, entry.Rank)
+}
+
+func TestRanker_CheckBrokenSkiplist(t *testing.T) {
+	r := New(WithStorageDir(t.TempDir()))
+	assert.NoError(t, r.Start())
+	defer r.Close()
+
+	assert.NoError(t, r.Update("a", 1))
+	assert.NoError(t, r.Update("b", 2))
+	r.zset.zset.zsl.head.level[0].forward.level[0].span = 7
+
+	report, err := r.Check(true)
+	assert.NoError(t, err)
+	assert.NotEmpty(t, report.Structure)
+	assert.True(t, report.Repaired)
+	assert.NoError(t, r.Verify())
+}
@@ -1,9 +1,15 @@
 package ranker
 
 import (
+	"encoding/base64"
+	"encoding/binary"
 	"errors"
+	"fmt"
+	"iter"
 	"math"
 	"math/rand"
+	"slices"
+	"strings"
 )
 
 const (
@@ -14,6 +20,8 @@ const (
 var (
 	ErrKeyNotExist   = errors.New("key not exist")
 	ErrInvalidParams = errors.New("invalid params")
+	ErrNotSorted     = errors.New("input not sorted")
+	ErrInvalidCursor = errors.New("invalid cursor")
 )
 
 type (
@@ -105,7 +113,8 @@ func newZSkipList() *zskiplist {
 }
 
 // insert 将一个新节点插入跳表中，假设插入的元素在跳表中不存在
-func (z *zskiplist) insert(score float64, member string) *zskiplistNode {
+// 返回新节点及其按分数从低到高的排名（1-based），排名在查找插入位置时顺带得到
+func (z *zskiplist) insert(score float64, member string) (*zskiplistNode, uint64) {
 	// 用于存储插入位置的节点
 	updates := make([]*zskiplistNode, SKIPLIST_MAXLEVEL)
 	// 用于存储每一层的排名
@@ -176,7 +185,7 @@ func (z *zskiplist) insert(score float64, member string) *zskiplistNode {
 	}
 
 	z.length++ // 增加跳表的长度
-	return x
+	return x, rank[0] + 1
 }
 
 // deleteNode 删除跳表中的节点
@@ -253,6 +262,59 @@ func (z *zskiplist) getRank(score float64, member string) int64 {
 	return 0
 }
 
+// validate 检查跳表的结构是否满足 insert/deleteNode 维护的不变式：
+// 第 0 层严格递增、backward 指针、尾节点、长度，以及每一层前进指针的跨度等于实际跨越的节点数
+func (z *zskiplist) validate() error {
+	if z.level < 1 || z.level > SKIPLIST_MAXLEVEL {
+		return fmt.Errorf("invalid level %d", z.level)
+	}
+
+	// 记录每个节点在第 0 层的排名（1-based）
+	ranks := make(map[*zskiplistNode]uint64, z.length)
+	var prev *zskiplistNode
+	var rank uint64
+	for x := z.head.level[0].forward; x != nil; x = x.level[0].forward {
+		rank++
+		ranks[x] = rank
+		if x.backward != prev {
+			return fmt.Errorf("member %q has a wrong backward pointer", x.member)
+		}
+		if prev != nil && !(prev.score < x.score || (prev.score == x.score && prev.member < x.member)) {
+			return fmt.Errorf("member %q is out of order", x.member)
+		}
+		if len(x.level) > z.level {
+			return fmt.Errorf("member %q has %d levels, list has %d", x.member, len(x.level), z.level)
+		}
+		prev = x
+	}
+	if int64(rank) != z.length {
+		return fmt.Errorf("length is %d but %d nodes are linked", z.length, rank)
+	}
+	if z.tail != prev {
+		return errors.New("tail does not point at the last node")
+	}
+
+	for i := 0; i < z.level; i++ {
+		var from uint64
+		for x := z.head; x.level[i].forward != nil; x = x.level[i].forward {
+			to, ok := ranks[x.level[i].forward]
+			if !ok {
+				return fmt.Errorf("level %d links a node missing from level 0", i)
+			}
+			if to-from != x.level[i].span {
+				return fmt.Errorf("level %d span after rank %d is %d, want %d", i, from, x.level[i].span, to-from)
+			}
+			from = to
+		}
+	}
+	for i := z.level; i < SKIPLIST_MAXLEVEL; i++ {
+		if z.head.level[i].forward != nil {
+			return fmt.Errorf("level %d is above the list level but not empty", i)
+		}
+	}
+	return nil
+}
+
 // 根据排名获取节点
 func (z *zskiplist) getNodeByRank(rank uint64) *zskiplistNode {
 	var traversed uint64 = 0
@@ -273,6 +335,90 @@ func (z *zskiplist) getNodeByRank(rank uint64) *zskiplistNode {
 	return nil
 }
 
+// lastBefore 返回排在 (score, member) 之前的最后一个节点及其排名（1-based），inclusive 为 true 时也包括与其相等的节点，
+// (score, member) 不必存在；没有这样的节点时返回头节点和 0
+func (z *zskiplist) lastBefore(score float64, member string, inclusive bool) (*zskiplistNode, uint64) {
+	var rank uint64 = 0
+	x := z.head
+	for i := z.level - 1; i >= 0; i-- {
+		for x.level[i].forward != nil &&
+			(x.level[i].forward.score < score ||
+				(x.level[i].forward.score == score &&
+					(x.level[i].forward.member < member ||
+						(inclusive && x.level[i].forward.member == member)))) {
+			rank += x.level[i].span
+			x = x.level[i].forward
+		}
+	}
+	return x, rank
+}
+
+// lastBelowScore 返回分数小于 score 的最后一个节点及其排名（1-based），inclusive 为 true 时也包括分数等于 score 的节点；
+// 没有这样的节点时返回头节点和 0
+func (z *zskiplist) lastBelowScore(score float64, inclusive bool) (*zskiplistNode, uint64) {
+	var rank uint64 = 0
+	x := z.head
+	for i := z.level - 1; i >= 0; i-- {
+		for x.level[i].forward != nil &&
+			(x.level[i].forward.score < score ||
+				(inclusive && x.level[i].forward.score == score)) {
+			rank += x.level[i].span
+			x = x.level[i].forward
+		}
+	}
+	return x, rank
+}
+
+// countUpTo 返回排在 (score, member) 之前或与其相等的节点数量，(score, member) 不必存在
+func (z *zskiplist) countUpTo(score float64, member string) uint64 {
+	_, count := z.lastBefore(score, member, true)
+	return count
+}
+
+// countScore 返回分数小于 score 的节点数量，inclusive 为 true 时也包括分数等于 score 的节点
+func (z *zskiplist) countScore(score float64, inclusive bool) uint64 {
+	_, count := z.lastBelowScore(score, inclusive)
+	return count
+}
+
+// lastWhile 返回从头开始连续满足 pred 的最后一个节点及其排名（1-based），pred 必须对一段前缀成立、
+// 对其余节点不成立；没有这样的节点时返回头节点和 0
+func (z *zskiplist) lastWhile(pred func(x *zskiplistNode) bool) (*zskiplistNode, uint64) {
+	var rank uint64 = 0
+	x := z.head
+	for i := z.level - 1; i >= 0; i-- {
+		for x.level[i].forward != nil && pred(x.level[i].forward) {
+			rank += x.level[i].span
+			x = x.level[i].forward
+		}
+	}
+	return x, rank
+}
+
+// deleteRange 删除第一个不满足 before 的节点开始、连续满足 in 的所有节点，同时从字典中移除，返回删除的数量
+// before 必须对一段前缀成立，与 lastWhile 相同；整体为 O(log(N)+M)，M 为删除的数量
+func (z *zset) deleteRange(before, in func(x *zskiplistNode) bool) int64 {
+	zsl := z.zsl
+	update := make([]*zskiplistNode, SKIPLIST_MAXLEVEL)
+	x := zsl.head
+	for i := zsl.level - 1; i >= 0; i-- {
+		for x.level[i].forward != nil && before(x.level[i].forward) {
+			x = x.level[i].forward
+		}
+		update[i] = x
+	}
+
+	// 删除节点只会修改 update 中节点的指针，因此 update 在整个删除过程中保持有效
+	var removed int64
+	for x = x.level[0].forward; x != nil && in(x); removed++ {
+		next := x.level[0].forward
+		zsl.deleteNode(x, update)
+		delete(z.dict, x.member)
+		x = next
+	}
+	return removed
+}
+
 // 根据排名获取节点，并返回节点的 member 和 score
 func (z *zset) getNodeByRank(rank int64, reverse bool) (string, float64) {
 	// 检查排名范围是否合法
@@ -421,6 +567,73 @@ func (z *zset) findRange(start, stop int64, reverse bool) (val []any) {
 	return
 }
 
+// zskiplistBuilder 从已按 (score, member) 升序排列的输入直接构建跳表
+// 每个节点只需追加到各层的末尾，不需要自顶向下查找插入位置，整体为 O(N)
+type zskiplistBuilder struct {
+	zsl      *zskiplist
+	last     [SKIPLIST_MAXLEVEL]*zskiplistNode // 每一层当前的最后一个节点
+	lastRank [SKIPLIST_MAXLEVEL]uint64         // 每一层最后一个节点的排名（1-based）
+}
+
+// newZSkipListBuilder 创建一个从跳表 z 末尾继续追加的构建器
+// 自顶向下走到每一层的最后一个节点并记录其排名，时间复杂度为 O(log(N))
+func newZSkipListBuilder(z *zskiplist) *zskiplistBuilder {
+	b := &zskiplistBuilder{zsl: z}
+	for i := range b.last {
+		b.last[i] = z.head
+	}
+
+	x := z.head
+	var rank uint64
+	for i := z.level - 1; i >= 0; i-- {
+		for x.level[i].forward != nil {
+			rank += x.level[i].span
+			x = x.level[i].forward
+		}
+		b.last[i] = x
+		b.lastRank[i] = rank
+	}
+	return b
+}
+
+// after 判断 (score, member) 是否严格排在跳表当前尾节点之后
+func (b *zskiplistBuilder) after(score float64, member string) bool {
+	tail := b.zsl.tail
+	return tail == nil || tail.score < score || (tail.score == score && tail.member < member)
+}
+
+// append 将节点追加到跳表末尾，调用方需保证输入严格递增
+func (b *zskiplistBuilder) append(score float64, member string) *zskiplistNode {
+	z := b.zsl
+	level := randomLevel()
+	if level > z.level {
+		z.level = level
+	}
+
+	x := createNode(level, score, member)
+	rank := uint64(z.length) + 1
+	for i := 0; i < level; i++ {
+		b.last[i].level[i].forward = x
+		b.last[i].level[i].span = rank - b.lastRank[i]
+		b.last[i] = x
+		b.lastRank[i] = rank
+	}
+
+	x.backward = z.tail
+	z.tail = x
+	z.length++
+	return x
+}
+
+// finish 补齐每一层最后一个节点的跨度，与 insert 维护的结果保持一致
+func (b *zskiplistBuilder) finish() *zskiplist {
+	z := b.zsl
+	for i := 0; i < z.level; i++ {
+		b.last[i].level[i].span = uint64(z.length) - b.lastRank[i]
+	}
+	return z
+}
+
 // 创建一个新的 ZSet 对象
 func NewZSet() *ZSet {
 	return &ZSet{
@@ -431,6 +644,52 @@ func NewZSet() *ZSet {
 	}
 }
 
+// NewZSetFromSorted 从按 (score, member) 升序排列的序列直接构建 ZSet，时间复杂度为 O(N)
+// 序列依次产生 member 和 score，与 ZSet.All 的输出顺序一致；输入未严格递增时返回 ErrNotSorted
+func NewZSetFromSorted(seq iter.Seq2[string, float64]) (*ZSet, error) {
+	z := NewZSet()
+	if err := z.BulkLoad(seq); err != nil {
+		return nil, err
+	}
+	return z, nil
+}
+
+// BulkLoad 将按 (score, member) 升序排列的序列追加到有序集合末尾
+// 每个元素只需挂到各层的最后一个节点之后，整体为 O(N)，适合启动时从已排序的数据重建
+// 第一个元素必须排在当前最后一个成员之后，且序列必须严格递增、成员不能重复，否则返回 ErrNotSorted；
+// 出错时已追加的元素会保留在集合中
+func (z *ZSet) BulkLoad(seq iter.Seq2[string, float64]) error {
+	n := z.zset
+	b := newZSkipListBuilder(n.zsl)
+	defer b.finish()
+
+	for member, score := range seq {
+		if _, exist := n.dict[member]; exist || !b.after(score, member) {
+			return ErrNotSorted
+		}
+		n.dict[member] = b.append(score, member)
+	}
+	return nil
+}
+
+// Verify 检查有序集合的内部一致性：跳表结构的不变式（见 validate），
+// 以及字典与跳表节点之间一一对应、成员和分数一致
+func (z *ZSet) Verify() error {
+	n := z.zset
+	if err := n.zsl.validate(); err != nil {
+		return err
+	}
+	if int64(len(n.dict)) != n.zsl.length {
+		return fmt.Errorf("dict has %d members but the list has %d", len(n.dict), n.zsl.length)
+	}
+	for x := n.zsl.head.level[0].forward; x != nil; x = x.level[0].forward {
+		if n.dict[x.member] != x {
+			return fmt.Errorf("dict entry of member %q does not point at its node", x.member)
+		}
+	}
+	return nil
+}
+
 // ZAdd 将指定的成员和分数添加到指定的有序集合中
 // 该方法的时间复杂度是 O(log(N))
 func (z *ZSet) ZAdd(score float64, member string) (val int, err error) {
@@ -441,12 +700,12 @@ func (z *ZSet) ZAdd(score float64, member string) (val int, err error) {
 		// 如果 score 改变，删除并重新插入
 		if score != v.score {
 			z.zset.zsl.delete(v.score, member)
-			node = z.zset.zsl.insert(score, member)
+			node, _ = z.zset.zsl.insert(score, member)
 		}
 	} else {
 		val = 1
 		// 如果元素不存在，直接插入
-		node = z.zset.zsl.insert(score, member)
+		node, _ = z.zset.zsl.insert(score, member)
 	}
 
 	// 更新字典中的节点
@@ -456,6 +715,42 @@ func (z *ZSet) ZAdd(score float64, member string) (val int, err error) {
 	return
 }
 
+// ZAddWithRevRank 与 ZAdd 相同，同时返回成员更新前后按分数从高到低的排名（0-based）
+// 成员原先不存在时 oldRank 为 -1；新排名直接取自 insert 查找插入位置时累计的跨度，
+// 因此整体时间复杂度仍是 O(log(N))
+func (z *ZSet) ZAddWithRevRank(score float64, member string) (oldRank, newRank int64, err error) {
+	n := z.zset
+	v, exist := n.dict[member]
+	if !exist {
+		node, rank := n.zsl.insert(score, member)
+		n.dict[member] = node
+		return -1, n.zsl.length - int64(rank), nil
+	}
+
+	oldRank = n.zsl.length - n.zsl.getRank(v.score, member)
+	if score == v.score {
+		return oldRank, oldRank, nil
+	}
+
+	n.zsl.delete(v.score, member)
+	node, rank := n.zsl.insert(score, member)
+	n.dict[member] = node
+	return oldRank, n.zsl.length - int64(rank), nil
+}
+
+// ZRevMemberByRank 返回按分数从高到低排名（0-based）为 rank 的成员，排名越界时返回 ErrKeyNotExist
+func (z *ZSet) ZRevMemberByRank(rank int64) (string, error) {
+	n := z.zset
+	if rank < 0 || rank >= n.zsl.length {
+		return "", ErrKeyNotExist
+	}
+	x := n.zsl.getNodeByRank(uint64(n.zsl.length - rank))
+	if x == nil {
+		return "", ErrKeyNotExist
+	}
+	return x.member, nil
+}
+
 // ZScore 返回指定成员在指定有序集合中的分数。
 func (z *ZSet) ZScore(member string) (score float64, err error) {
 
@@ -539,6 +834,44 @@ func (z *ZSet) ZRem(member string) error {
 	return ErrKeyNotExist
 }
 
+// ZRemRangeByRank 实现了 Redis 的 ZREMRANGEBYRANK 命令，删除按分数从低到高排名（0-based）在 start 和 stop 之间的成员
+// （包括 start 和 stop），负数表示从末尾倒数，与 ZRange 相同；整段节点一次遍历摘除，返回删除的数量
+func (z *ZSet) ZRemRangeByRank(start, stop int) int64 {
+	zsl := z.zset.zsl
+	length := int(zsl.length)
+	if start < 0 {
+		start = max(start+length, 0)
+	}
+	if stop < 0 {
+		stop += length
+	}
+	stop = min(stop, length-1)
+	if start > stop {
+		return 0
+	}
+
+	first := zsl.getNodeByRank(uint64(start + 1))
+	n := stop - start + 1
+	return z.zset.deleteRange(
+		func(x *zskiplistNode) bool {
+			return x.score < first.score || (x.score == first.score && x.member < first.member)
+		},
+		func(x *zskiplistNode) bool {
+			n--
+			return n >= 0
+		},
+	)
+}
+
+// ZRemRangeByScore 实现了 Redis 的 ZREMRANGEBYSCORE 命令，删除分数在 min 和 max 之间的成员（包括 min 和 max），
+// 整段节点一次遍历摘除，返回删除的数量
+func (z *ZSet) ZRemRangeByScore(min, max float64) int64 {
+	return z.zset.deleteRange(
+		func(x *zskiplistNode) bool { return x.score < min },
+		func(x *zskiplistNode) bool { return x.score <= max },
+	)
+}
+
 // ZScoreRange 返回有序集合中分数在 min 和 max 之间的元素（包括 min 和 max 的元素），按分数从低到高排序
 func (z *ZSet) ZScoreRange(min, max float64) (val []interface{}, err error) {
 
@@ -606,6 +939,86 @@ func (z *ZSet) ZRevScoreRange(max, min float64) (val []Z, err error) {
 	return
 }
 
+// ZCount 返回分数在 min 和 max 之间的成员数量（包括 min 和 max），max 小于 min 时返回 0
+func (z *ZSet) ZCount(min, max float64) int64 {
+	if max < min {
+		return 0
+	}
+	zsl := z.zset.zsl
+	return int64(zsl.countScore(max, true) - zsl.countScore(min, false))
+}
+
+// ZCountAbove 返回按分数从高到低排序时排在 (score, member) 之前的成员数量，
+// 即分数大于 score，或分数等于 score 且成员大于 member 的成员数量，(score, member) 不必存在
+func (z *ZSet) ZCountAbove(score float64, member string) int64 {
+	zsl := z.zset.zsl
+	return zsl.length - int64(zsl.countUpTo(score, member))
+}
+
+// All 按分数从低到高依次产生所有成员及其分数，不会复制元素；迭代期间不能修改有序集合
+func (z *ZSet) All() iter.Seq2[string, float64] {
+	return func(yield func(string, float64) bool) {
+		for x := z.zset.zsl.head.level[0].forward; x != nil; x = x.level[0].forward {
+			if !yield(x.member, x.score) {
+				return
+			}
+		}
+	}
+}
+
+// Backward 按分数从高到低依次产生所有成员及其分数；迭代期间不能修改有序集合
+func (z *ZSet) Backward() iter.Seq2[string, float64] {
+	return func(yield func(string, float64) bool) {
+		for x := z.zset.zsl.tail; x != nil; x = x.backward {
+			if !yield(x.member, x.score) {
+				return
+			}
+		}
+	}
+}
+
+// RangeByRank 按分数从低到高产生排名（0-based）在 start 和 stop 之间的成员及其分数（包括 start 和 stop），
+// 负数表示从末尾倒数，与 ZRange 相同；范围在每次开始迭代时确定，迭代期间不能修改有序集合
+func (z *ZSet) RangeByRank(start, stop int) iter.Seq2[string, float64] {
+	return func(yield func(string, float64) bool) {
+		zsl := z.zset.zsl
+		length := int(zsl.length)
+		first, last := start, stop
+		if first < 0 {
+			first = max(first+length, 0)
+		}
+		if last < 0 {
+			last += length
+		}
+		last = min(last, length-1)
+		if first > last {
+			return
+		}
+
+		// 从第 first+1 个节点（1-based）开始沿第 0 层前进
+		x := zsl.getNodeByRank(uint64(first + 1))
+		for n := last - first + 1; n > 0; n-- {
+			if !yield(x.member, x.score) {
+				return
+			}
+			x = x.level[0].forward
+		}
+	}
+}
+
+// RangeByScore 按分数从低到高产生分数在 min 和 max 之间的成员及其分数（包括 min 和 max），
+// 定位起点的时间复杂度为 O(log(N))；迭代期间不能修改有序集合
+func (z *ZSet) RangeByScore(min, max float64) iter.Seq2[string, float64] {
+	return func(yield func(string, float64) bool) {
+		x, _ := z.zset.zsl.lastBelowScore(min, false)
+		for x = x.level[0].forward; x != nil && x.score <= max; x = x.level[0].forward {
+			if !yield(x.member, x.score) {
+				return
+			}
+		}
+	}
+}
+
 // ZRange 获取指定范围内的 zset 元素
 func (z *ZSet) ZRange(start, stop int) ([]interface{}, error) {
 	n := z.zset
@@ -774,31 +1187,446 @@ func (z *ZSet) ZRangeByScore(start, end float64, options *ZRangeOptions) (nodes
 	return nodes
 }
 
-// ZScan 实现了类似于 Redis 中的 ZSCAN 命令
-func (z *ZSet) ZScan(cursor uint64, count int64) ([]any, uint64, error) {
+// zlexRange 表示字典序区间，由 parseLexRange 从 Redis 风格的边界解析得到
+type zlexRange struct {
+	min, max     string
+	minInf       bool // min 为 "-"，不设下界
+	maxInf       bool // max 为 "+"，不设上界
+	minEx, maxEx bool // 边界以 "(" 开头，不包括边界本身
+	empty        bool // min 为 "+" 或 max 为 "-"，区间为空
+}
 
-	end := int(cursor)
-	if end == 0 {
-		end = z.ZCard()
+// parseLexRange 解析 ZRangeByLex 等方法的边界：
+// "[abc" 包括 abc，"(abc" 不包括 abc，"-" 表示负无穷，"+" 表示正无穷，其他格式返回 ErrInvalidParams
+func parseLexRange(min, max string) (*zlexRange, error) {
+	r := &zlexRange{}
+	var err error
+	if r.min, r.minEx, err = parseLexBound(min); err != nil {
+		return nil, err
 	}
+	if r.max, r.maxEx, err = parseLexBound(max); err != nil {
+		return nil, err
+	}
+	r.minInf, r.maxInf = min == "-", max == "+"
+	r.empty = min == "+" || max == "-"
+	return r, nil
+}
 
-	start := end - int(count)
+// parseLexBound 解析单个边界，返回去掉前缀的值以及是否排除边界
+func parseLexBound(bound string) (string, bool, error) {
+	switch {
+	case bound == "-" || bound == "+":
+		return "", false, nil
+	case strings.HasPrefix(bound, "["):
+		return bound[1:], false, nil
+	case strings.HasPrefix(bound, "("):
+		return bound[1:], true, nil
+	}
+	return "", false, ErrInvalidParams
+}
 
-	if start < 0 {
-		start = 0
+// gteMin 判断 member 是否满足下界
+func (r *zlexRange) gteMin(member string) bool {
+	if r.minInf {
+		return true
+	}
+	if r.minEx {
+		return member > r.min
 	}
+	return member >= r.min
+}
 
-	// 获取完整的有序集合
-	items, err := z.ZRange(start, end-1)
+// lteMax 判断 member 是否满足上界
+func (r *zlexRange) lteMax(member string) bool {
+	if r.maxInf {
+		return true
+	}
+	if r.maxEx {
+		return member < r.max
+	}
+	return member <= r.max
+}
 
+// lexBounds 返回区间内的第一个和最后一个节点，区间为空时返回 nil
+// 与 Redis 相同，按字典序比较只在所有成员分数相同时有意义，此时跳表按成员排序
+func (z *zskiplist) lexBounds(r *zlexRange) (first, last *zskiplistNode) {
+	if r.empty {
+		return nil, nil
+	}
+	first, _ = z.lastWhile(func(x *zskiplistNode) bool { return !r.gteMin(x.member) })
+	first = first.level[0].forward
+	last, _ = z.lastWhile(func(x *zskiplistNode) bool { return r.lteMax(x.member) })
+	if first == nil || last == z.head || !r.lteMax(first.member) || !r.gteMin(last.member) {
+		return nil, nil
+	}
+	return first, last
+}
+
+// ZRangeByLex 实现了 Redis 的 ZRANGEBYLEX 命令，按字典序从低到高返回 min 和 max 之间的成员，
+// 边界格式见 parseLexRange；跳过前 offset 个成员后最多返回 count 个，count 小于 0 时不限数量
+// 只在所有成员分数相同时结果才有意义
+func (z *ZSet) ZRangeByLex(min, max string, offset, count int) ([]string, error) {
+	r, err := parseLexRange(min, max)
+	if err != nil {
+		return nil, err
+	}
+	first, last := z.zset.zsl.lexBounds(r)
+	members := []string{}
+	if first == nil {
+		return members, nil
+	}
+	for x := first; x != last.level[0].forward && count != 0; x = x.level[0].forward {
+		if offset > 0 {
+			offset--
+			continue
+		}
+		members = append(members, x.member)
+		count--
+	}
+	return members, nil
+}
+
+// ZRevRangeByLex 实现了 Redis 的 ZREVRANGEBYLEX 命令，与 ZRangeByLex 相同但按字典序从高到低返回，
+// 参数顺序与 Redis 一致，先上界后下界
+func (z *ZSet) ZRevRangeByLex(max, min string, offset, count int) ([]string, error) {
+	r, err := parseLexRange(min, max)
 	if err != nil {
-		return nil, 0, err
+		return nil, err
 	}
+	first, last := z.zset.zsl.lexBounds(r)
+	members := []string{}
+	if first == nil {
+		return members, nil
+	}
+	for x := last; x != first.backward && count != 0; x = x.backward {
+		if offset > 0 {
+			offset--
+			continue
+		}
+		members = append(members, x.member)
+		count--
+	}
+	return members, nil
+}
 
-	// 如果集合为空
-	if len(items) == 0 {
-		return items, 0, nil
+// ZLexCount 实现了 Redis 的 ZLEXCOUNT 命令，返回字典序在 min 和 max 之间的成员数量，时间复杂度为 O(log(N))
+func (z *ZSet) ZLexCount(min, max string) (int64, error) {
+	r, err := parseLexRange(min, max)
+	if err != nil {
+		return 0, err
 	}
+	if r.empty {
+		return 0, nil
+	}
+	zsl := z.zset.zsl
+	_, below := zsl.lastWhile(func(x *zskiplistNode) bool { return !r.gteMin(x.member) })
+	_, upTo := zsl.lastWhile(func(x *zskiplistNode) bool { return r.lteMax(x.member) })
+	if upTo <= below {
+		return 0, nil
+	}
+	return int64(upTo - below), nil
+}
 
-	return items, uint64(start), nil
+// ZRemRangeByLex 实现了 Redis 的 ZREMRANGEBYLEX 命令，删除字典序在 min 和 max 之间的成员，返回删除的数量
+func (z *ZSet) ZRemRangeByLex(min, max string) (int64, error) {
+	r, err := parseLexRange(min, max)
+	if err != nil {
+		return 0, err
+	}
+	if r.empty {
+		return 0, nil
+	}
+	return z.zset.deleteRange(
+		func(x *zskiplistNode) bool { return !r.gteMin(x.member) },
+		func(x *zskiplistNode) bool { return r.lteMax(x.member) },
+	), nil
+}
+
+// Aggregate 指定 ZUnion 和 ZInter 如何合并同一成员在各个集合中加权后的分数，与 Redis 的 AGGREGATE 选项相同
+type Aggregate int
+
+const (
+	AggregateSum Aggregate = iota // 分数相加，默认值
+	AggregateMin                  // 取最小的分数
+	AggregateMax                  // 取最大的分数
+)
+
+// ZAggregateOptions 用于指定 ZUnion 和 ZInter 的选项
+type ZAggregateOptions struct {
+	Weights   []float64 // 每个集合的分数先乘以对应的权重，为空时权重均为 1，否则数量必须与集合数量相同
+	Aggregate Aggregate // 合并分数的方式
+}
+
+// aggregateParams 校验 n 个集合的选项，返回每个集合的权重和合并方式
+func aggregateParams(n int, options *ZAggregateOptions) ([]float64, Aggregate, error) {
+	if n == 0 {
+		return nil, 0, ErrInvalidParams
+	}
+	weights := make([]float64, n)
+	for i := range weights {
+		weights[i] = 1
+	}
+	if options == nil {
+		return weights, AggregateSum, nil
+	}
+	if options.Weights != nil {
+		if len(options.Weights) != n || slices.ContainsFunc(options.Weights, math.IsNaN) {
+			return nil, 0, ErrInvalidParams
+		}
+		copy(weights, options.Weights)
+	}
+	switch options.Aggregate {
+	case AggregateSum, AggregateMin, AggregateMax:
+		return weights, options.Aggregate, nil
+	}
+	return nil, 0, ErrInvalidParams
+}
+
+// weightedScore 返回乘以权重后的分数，与 Redis 相同，无穷乘以 0 得到的 NaN 记为 0
+func weightedScore(score, weight float64) float64 {
+	if s := score * weight; !math.IsNaN(s) {
+		return s
+	}
+	return 0
+}
+
+// combine 按合并方式合并两个分数，与 Redis 相同，+inf 与 -inf 相加得到的 NaN 记为 0
+func (a Aggregate) combine(x, y float64) float64 {
+	switch a {
+	case AggregateMin:
+		return min(x, y)
+	case AggregateMax:
+		return max(x, y)
+	}
+	if s := x + y; !math.IsNaN(s) {
+		return s
+	}
+	return 0
+}
+
+// newZSetFromScores 由成员到分数的映射构建有序集合
+func newZSetFromScores(scores map[string]float64) *ZSet {
+	z := NewZSet()
+	for member, score := range scores {
+		z.ZAdd(score, member)
+	}
+	return z
+}
+
+// ZUnion 实现了 Redis 的 ZUNION 命令，返回包含所有输入集合成员的新集合，输入集合不会被修改
+// 成员的分数是它在所在的各个集合中的分数乘以权重后按 Aggregate 合并的结果；
+// 没有输入集合或选项无效时返回 ErrInvalidParams。时间复杂度为 O(N*log(M))，N 为输入集合的大小之和，M 为结果的大小
+func ZUnion(sets []*ZSet, options *ZAggregateOptions) (*ZSet, error) {
+	weights, aggregate, err := aggregateParams(len(sets), options)
+	if err != nil {
+		return nil, err
+	}
+	scores := make(map[string]float64)
+	for i, z := range sets {
+		for x := z.zset.zsl.head.level[0].forward; x != nil; x = x.level[0].forward {
+			score := weightedScore(x.score, weights[i])
+			if old, exist := scores[x.member]; exist {
+				score = aggregate.combine(old, score)
+			}
+			scores[x.member] = score
+		}
+	}
+	return newZSetFromScores(scores), nil
+}
+
+// ZInter 实现了 Redis 的 ZINTER 命令，返回只包含在所有输入集合中都存在的成员的新集合，分数的计算方式与 ZUnion 相同
+// 从最小的集合出发逐个检查成员是否在其他集合中，时间复杂度为 O(N*K + M*log(M))，N 为最小集合的大小，K 为集合数量
+func ZInter(sets []*ZSet, options *ZAggregateOptions) (*ZSet, error) {
+	weights, aggregate, err := aggregateParams(len(sets), options)
+	if err != nil {
+		return nil, err
+	}
+	smallest := sets[0]
+	for _, z := range sets[1:] {
+		if z.ZCard() < smallest.ZCard() {
+			smallest = z
+		}
+	}
+
+	scores := make(map[string]float64)
+next:
+	for member := range smallest.zset.dict {
+		var score float64
+		for i, z := range sets {
+			x, exist := z.zset.dict[member]
+			if !exist {
+				continue next
+			}
+			if s := weightedScore(x.score, weights[i]); i == 0 {
+				score = s
+			} else {
+				score = aggregate.combine(score, s)
+			}
+		}
+		scores[member] = score
+	}
+	return newZSetFromScores(scores), nil
+}
+
+// ZDiff 实现了 Redis 的 ZDIFF 命令，返回第一个集合中不属于其他任何集合的成员组成的新集合，分数保持不变；
+// 没有输入集合时返回 ErrInvalidParams。结果按第一个集合的顺序直接构建，时间复杂度为 O(N*K)，N 为第一个集合的大小
+func ZDiff(sets []*ZSet) (*ZSet, error) {
+	if len(sets) == 0 {
+		return nil, ErrInvalidParams
+	}
+	return NewZSetFromSorted(func(yield func(string, float64) bool) {
+	next:
+		for x := sets[0].zset.zsl.head.level[0].forward; x != nil; x = x.level[0].forward {
+			for _, z := range sets[1:] {
+				if _, exist := z.zset.dict[x.member]; exist {
+					continue next
+				}
+			}
+			if !yield(x.member, x.score) {
+				return
+			}
+		}
+	})
+}
+
+// ZScanOptions 用于指定 ZScan 的选项
+type ZScanOptions struct {
+	Match string // 成员需匹配的 glob 模式，支持 *、?、[...] 和 \ 转义，为空时匹配所有成员
+	Count int    // 每次调用最多检查的成员数量，小于等于 0 时为 10，与 Redis 的 COUNT 相同
+}
+
+// ZScan 实现了类似于 Redis 中的 ZSCAN 命令，按 (score, member) 从低到高分批返回成员及其分数
+// 游标是上一批最后检查的位置编码成的不透明字符串，首次调用传入空字符串，返回空字符串表示扫描结束；
+// 游标只记录位置而不是排名，因此两次调用之间插入或删除其他成员不会影响结果：
+// 整个扫描期间都存在且分数不变的成员恰好返回一次，扫描期间新增、删除或改变分数的成员可能返回也可能不返回
+// Match 在检查之后过滤，因此一批的结果可能少于 Count，甚至为空但游标不为空
+func (z *ZSet) ZScan(cursor string, options *ZScanOptions) ([]Z, string, error) {
+	count, match := 10, ""
+	if options != nil {
+		if options.Count > 0 {
+			count = options.Count
+		}
+		match = options.Match
+	}
+
+	zsl := z.zset.zsl
+	x := zsl.head
+	if cursor != "" {
+		score, member, err := decodeZScanCursor(cursor)
+		if err != nil {
+			return nil, "", err
+		}
+		// 从严格排在游标位置之后的第一个节点继续，游标位置上的成员不必仍然存在
+		x, _ = zsl.lastBefore(score, member, true)
+	}
+
+	var items []Z
+	for i := 0; i < count && x.level[0].forward != nil; i++ {
+		x = x.level[0].forward
+		if match == "" || matchPattern(match, x.member) {
+			items = append(items, Z{Score: x.score, Member: x.member})
+		}
+	}
+	if x.level[0].forward == nil {
+		return items, "", nil
+	}
+	return items, encodeZScanCursor(x.score, x.member), nil
+}
+
+// encodeZScanCursor 将 (score, member) 位置编码为 ZScan 的游标
+func encodeZScanCursor(score float64, member string) string {
+	buf := make([]byte, 8, 8+len(member))
+	binary.BigEndian.PutUint64(buf, math.Float64bits(score))
+	buf = append(buf, member...)
+	return base64.RawURLEncoding.EncodeToString(buf)
+}
+
+// decodeZScanCursor 解析 encodeZScanCursor 生成的游标，格式错误时返回 ErrInvalidCursor
+func decodeZScanCursor(cursor string) (float64, string, error) {
+	buf, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil || len(buf) < 8 {
+		return 0, "", ErrInvalidCursor
+	}
+	return math.Float64frombits(binary.BigEndian.Uint64(buf)), string(buf[8:]), nil
+}
+
+// matchPattern 判断 s 是否匹配 Redis 风格的 glob 模式：
+// * 匹配任意字符串，? 匹配任意单个字符，[abc]、[a-z] 和 [^a] 匹配字符集合，\ 转义下一个字符
+// 遇到 * 时记录回溯位置，失配时让上一个 * 多吞一个字符，时间复杂度为 O(len(pattern)*len(s))
+func matchPattern(pattern, s string) bool {
+	p, i := 0, 0
+	starP, starI := -1, 0
+	for i < len(s) {
+		if p < len(pattern) {
+			switch pattern[p] {
+			case '*':
+				starP, starI = p, i
+				p++
+				continue
+			case '?':
+				p++
+				i++
+				continue
+			case '[':
+				if end, ok := matchClass(pattern, p, s[i]); ok {
+					p = end
+					i++
+					continue
+				}
+			case '\\':
+				if p+1 < len(pattern) && pattern[p+1] == s[i] {
+					p += 2
+					i++
+					continue
+				}
+			default:
+				if pattern[p] == s[i] {
+					p++
+					i++
+					continue
+				}
+			}
+		}
+		if starP < 0 {
+			return false
+		}
+		starI++
+		p, i = starP+1, starI
+	}
+	for p < len(pattern) && pattern[p] == '*' {
+		p++
+	}
+	return p == len(pattern)
+}
+
+// matchClass 判断字符 c 是否属于从 pattern[p] 的 '[' 开始的字符集合，返回集合之后的位置；
+// 缺少 ']' 时集合一直延续到模式末尾，与 Redis 相同
+func matchClass(pattern string, p int, c byte) (int, bool) {
+	p++
+	not := p < len(pattern) && pattern[p] == '^'
+	if not {
+		p++
+	}
+	matched := false
+	for p < len(pattern) && pattern[p] != ']' {
+		switch {
+		case pattern[p] == '\\' && p+1 < len(pattern):
+			p++
+			matched = matched || pattern[p] == c
+		case p+2 < len(pattern) && pattern[p+1] == '-' && pattern[p+2] != ']':
+			lo, hi := pattern[p], pattern[p+2]
+			if lo > hi {
+				lo, hi = hi, lo
+			}
+			matched = matched || (lo <= c && c <= hi)
+			p += 2
+		default:
+			matched = matched || pattern[p] == c
+		}
+		p++
+	}
+	if p < len(pattern) {
+		p++ // 跳过 ']'
+	}
+	return p, matched != not
 }
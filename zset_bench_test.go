@@ -17,6 +17,23 @@ func BenchmarkZAdd(b *testing.B) {
 	}
 }
 
+func BenchmarkBulkLoad(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		NewZSetFromSorted(sortedSeq(100000))
+	}
+}
+
+func BenchmarkZAddSorted(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		n := NewZSet()
+		for member, score := range sortedSeq(100000) {
+			n.ZAdd(score, member)
+		}
+	}
+}
+
 func BenchmarkMapSet(b *testing.B) {
 	n := make(map[string]float64, 0)
 	b.ResetTimer()
@@ -1,6 +1,10 @@
 package ranker
 
 import (
+	"fmt"
+	"iter"
+	"math"
+	"math/rand"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -94,51 +98,573 @@ func TestZSet_ZRevRange(t *testing.T) {
 func TestZSet_ZScan(t *testing.T) {
 	n := makeZSet()
 
-	items, cursor, err := n.ZScan(0, 2)
+	items, cursor, err := n.ZScan("", &ZScanOptions{Count: 2})
 	assert.NoError(t, err)
-	assert.Equal(t, 2, len(items))
-	assert.Equal(t, uint64(5), cursor)
+	assert.Equal(t, []Z{{Score: 1, Member: "ced"}, {Score: 2, Member: "acd"}}, items)
+	assert.NotEmpty(t, cursor)
 
-	items, cursor, err = n.ZScan(cursor, 2)
+	items, cursor, err = n.ZScan(cursor, &ZScanOptions{Count: 2})
 	assert.NoError(t, err)
-	assert.Equal(t, 2, len(items))
-	assert.Equal(t, uint64(3), cursor)
+	assert.Equal(t, []Z{{Score: 3, Member: "bcd"}, {Score: 4, Member: "acc"}}, items)
+	assert.NotEmpty(t, cursor)
 
-	items, cursor, err = n.ZScan(cursor, 4)
+	items, cursor, err = n.ZScan(cursor, &ZScanOptions{Count: 4})
 	assert.NoError(t, err)
 	assert.Equal(t, 3, len(items))
-	assert.Equal(t, uint64(0), cursor)
+	assert.Equal(t, "", cursor)
+
+	// The default count covers the whole set.
+	items, cursor, err = n.ZScan("", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, 7, len(items))
+	assert.Equal(t, "", cursor)
+
+	_, _, err = n.ZScan("!", nil)
+	assert.ErrorIs(t, err, ErrInvalidCursor)
+	_, _, err = n.ZScan("AAAA", nil)
+	assert.ErrorIs(t, err, ErrInvalidCursor)
 }
 
 func TestZSet_ZScanRem(t *testing.T) {
 	n := makeZSet()
 
-	items, cursor, err := n.ZScan(0, 2)
-	assert.Equal(t, 2, len(items))
+	// Removing scanned members doesn't shift the rest of the scan.
+	var seen []any
+	cursor := ""
+	for {
+		items, next, err := n.ZScan(cursor, &ZScanOptions{Count: 2})
+		assert.NoError(t, err)
+		for _, v := range items {
+			seen = append(seen, v.Member)
+			n.ZRem(v.Member.(string))
+		}
+		if cursor = next; cursor == "" {
+			break
+		}
+	}
+	assert.Equal(t, []any{"ced", "acd", "bcd", "acc", "mcd", "ccd", "ecd"}, seen)
+	assert.Equal(t, 0, n.ZCard())
+}
+
+func TestZSet_ZScanMutations(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	n := NewZSet()
+	for i := 0; i < 1000; i++ {
+		n.ZAdd(float64(rnd.Intn(100)), fmt.Sprintf("stable%d", i))
+	}
+
+	// Members are added and removed between calls, some of them landing
+	// before the cursor and some after; the stable ones are seen once.
+	seen := make(map[string]int)
+	cursor := ""
+	for round := 0; ; round++ {
+		items, next, err := n.ZScan(cursor, &ZScanOptions{Count: 7})
+		assert.NoError(t, err)
+		for _, v := range items {
+			seen[v.Member.(string)]++
+		}
+		for i := 0; i < 5; i++ {
+			n.ZAdd(float64(rnd.Intn(100)), fmt.Sprintf("new%d-%d", round, i))
+		}
+		if round > 0 {
+			n.ZRem(fmt.Sprintf("new%d-%d", round-1, rnd.Intn(5)))
+		}
+		if cursor = next; cursor == "" {
+			break
+		}
+	}
+	for i := 0; i < 1000; i++ {
+		assert.Equal(t, 1, seen[fmt.Sprintf("stable%d", i)])
+	}
+	for member, times := range seen {
+		assert.Equal(t, 1, times, member)
+	}
+}
+
+func TestZSet_ZScanMatch(t *testing.T) {
+	n := NewZSet()
+	for i := 0; i < 30; i++ {
+		n.ZAdd(float64(i), fmt.Sprintf("user:%d", i))
+		n.ZAdd(float64(i), fmt.Sprintf("bot:%d", i))
+	}
+
+	var matched []any
+	cursor := ""
+	for {
+		items, next, err := n.ZScan(cursor, &ZScanOptions{Match: "user:1?", Count: 5})
+		assert.NoError(t, err)
+		// Count bounds the members examined, not the ones returned.
+		assert.LessOrEqual(t, len(items), 5)
+		for _, v := range items {
+			matched = append(matched, v.Member)
+		}
+		if cursor = next; cursor == "" {
+			break
+		}
+	}
+	assert.Len(t, matched, 10)
+	assert.Equal(t, "user:10", matched[0])
+	assert.Equal(t, "user:19", matched[9])
+
+	for _, c := range []struct {
+		pattern, s string
+		match      bool
+	}{
+		{"*", "", true},
+		{"*", "abc", true},
+		{"a*c", "abbbc", true},
+		{"a*c", "abbbd", false},
+		{"a*b*c", "axbyc", true},
+		{"?", "", false},
+		{"h?llo", "hello", true},
+		{"h[ae]llo", "hallo", true},
+		{"h[ae]llo", "hillo", false},
+		{"h[^e]llo", "hallo", true},
+		{"h[^e]llo", "hello", false},
+		{"h[a-c]llo", "hbllo", true},
+		{"h[a-c]llo", "hdllo", false},
+		{"h\\*llo", "h*llo", true},
+		{"h\\*llo", "hallo", false},
+		{"*:[0-9]", "user:7", true},
+		{"*:[0-9]", "user:x", false},
+	} {
+		assert.Equal(t, c.match, matchPattern(c.pattern, c.s), "%q %q", c.pattern, c.s)
+	}
+}
+
+func TestZSet_ZAddWithRevRank(t *testing.T) {
+	n := makeZSet()
+
+	oldRank, newRank, err := n.ZAddWithRevRank(10, "ced")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(6), oldRank)
+	assert.Equal(t, int64(0), newRank)
+
+	oldRank, newRank, err = n.ZAddWithRevRank(4.5, "new")
 	assert.NoError(t, err)
-	assert.Equal(t, uint64(5), cursor)
+	assert.Equal(t, int64(-1), oldRank)
+	assert.Equal(t, int64(4), newRank)
 
-	for _, v := range items {
-		n.ZRem(v.(string))
+	rank, err := n.ZRevRank("new")
+	assert.NoError(t, err)
+	assert.Equal(t, newRank, rank)
+
+	member, err := n.ZRevMemberByRank(0)
+	assert.NoError(t, err)
+	assert.Equal(t, "ced", member)
+	_, err = n.ZRevMemberByRank(8)
+	assert.ErrorIs(t, err, ErrKeyNotExist)
+}
+
+func sortedSeq(n int) func(yield func(string, float64) bool) {
+	return func(yield func(string, float64) bool) {
+		for i := 0; i < n; i++ {
+			if !yield(fmt.Sprintf("m%06d", i), float64(i/3)) {
+				return
+			}
+		}
 	}
+}
 
-	items, cursor, err = n.ZScan(cursor, 2)
+func TestZSet_NewZSetFromSorted(t *testing.T) {
+	bulk, err := NewZSetFromSorted(sortedSeq(5000))
 	assert.NoError(t, err)
-	assert.Equal(t, 2, len(items))
-	assert.Equal(t, uint64(3), cursor)
+	assert.NoError(t, bulk.zset.zsl.validate())
+
+	inserted := NewZSet()
+	for member, score := range sortedSeq(5000) {
+		inserted.ZAdd(score, member)
+	}
+	assert.NoError(t, inserted.zset.zsl.validate())
 
-	for _, v := range items {
-		n.ZRem(v.(string))
+	assert.Equal(t, inserted.ZCard(), bulk.ZCard())
+	want, _ := inserted.ZRevRangeWithScores(0, -1)
+	got, _ := bulk.ZRevRangeWithScores(0, -1)
+	assert.Equal(t, want, got)
+	for i := 0; i < 5000; i += 13 {
+		member := fmt.Sprintf("m%06d", i)
+		expected, _ := inserted.ZRevRank(member)
+		rank, err := bulk.ZRevRank(member)
+		assert.NoError(t, err)
+		assert.Equal(t, expected, rank)
 	}
 
-	items, cursor, err = n.ZScan(cursor, 4)
+	// The bulk-built list keeps working with regular inserts and deletes.
+	bulk.ZAdd(-1, "first")
+	bulk.ZAdd(1e9, "last")
+	bulk.ZRem("m000010")
+	assert.NoError(t, bulk.zset.zsl.validate())
+	rank, _ := bulk.ZRank("first")
+	assert.Equal(t, int64(0), rank)
+}
+
+func TestZSet_BulkLoad(t *testing.T) {
+	n := makeZSet()
+	err := n.BulkLoad(func(yield func(string, float64) bool) {
+		_ = yield("zzz", 8) && yield("aaa", 9) && yield("bbb", 9)
+	})
 	assert.NoError(t, err)
-	assert.Equal(t, 3, len(items))
-	assert.Equal(t, uint64(0), cursor)
+	assert.NoError(t, n.zset.zsl.validate())
+	assert.Equal(t, 10, n.ZCard())
+	rank, _ := n.ZRevRank("bbb")
+	assert.Equal(t, int64(0), rank)
+
+	err = n.BulkLoad(func(yield func(string, float64) bool) {
+		yield("ccc", 1)
+	})
+	assert.ErrorIs(t, err, ErrNotSorted)
+
+	_, err = NewZSetFromSorted(func(yield func(string, float64) bool) {
+		_ = yield("a", 1) && yield("a", 2)
+	})
+	assert.ErrorIs(t, err, ErrNotSorted)
+}
+
+func TestZSet_Verify(t *testing.T) {
+	n := makeZSet()
+	assert.NoError(t, n.Verify())
 
-	for _, v := range items {
-		n.ZRem(v.(string))
+	n.zset.dict["ced"] = n.zset.dict["acd"]
+	assert.Error(t, n.Verify())
+
+	n = makeZSet()
+	n.zset.zsl.tail = n.zset.zsl.tail.backward
+	assert.Error(t, n.Verify())
+}
+
+func TestZSet_ZCount(t *testing.T) {
+	n := NewZSet()
+	for i := 0; i < 100; i++ {
+		n.ZAdd(float64(i/10), fmt.Sprintf("m%02d", i))
 	}
+	assert.Equal(t, int64(100), n.ZCount(math.Inf(-1), math.Inf(1)))
+	assert.Equal(t, int64(30), n.ZCount(2, 4))
+	assert.Equal(t, int64(10), n.ZCount(9, 100))
+	assert.Equal(t, int64(0), n.ZCount(4, 2))
+	assert.Equal(t, int64(0), n.ZCount(2.5, 2.9))
 
+	assert.Equal(t, int64(0), n.ZCountAbove(9, "m99"))
+	assert.Equal(t, int64(10), n.ZCountAbove(8, "zzz"))
+	assert.Equal(t, int64(15), n.ZCountAbove(8, "m84"))
+	assert.Equal(t, int64(100), n.ZCountAbove(-1, ""))
+	for i := 0; i < 100; i += 7 {
+		member := fmt.Sprintf("m%02d", i)
+		rank, _ := n.ZRevRank(member)
+		assert.Equal(t, rank, n.ZCountAbove(float64(i/10), member))
+	}
+}
+
+// Collects the members of a sequence.
+func seqMembers(seq iter.Seq2[string, float64]) []string {
+	var members []string
+	for member := range seq {
+		members = append(members, member)
+	}
+	return members
+}
+
+func TestZSet_Iterators(t *testing.T) {
+	n := NewZSet()
+	for i := 0; i < 10; i++ {
+		n.ZAdd(float64(i/2), fmt.Sprintf("m%d", i))
+	}
+	all := []string{"m0", "m1", "m2", "m3", "m4", "m5", "m6", "m7", "m8", "m9"}
+	assert.Equal(t, all, seqMembers(n.All()))
+	assert.Equal(t, []string{"m9", "m8", "m7", "m6", "m5", "m4", "m3", "m2", "m1", "m0"}, seqMembers(n.Backward()))
+
+	for _, r := range [][2]int{{0, -1}, {2, 4}, {-3, -1}, {8, 100}, {-100, 1}, {5, 2}, {10, 20}} {
+		expected, _ := n.ZRange(r[0], r[1])
+		members := seqMembers(n.RangeByRank(r[0], r[1]))
+		assert.Equal(t, len(expected), len(members), r)
+		for i, member := range members {
+			assert.Equal(t, expected[i], member)
+		}
+	}
+
+	// Negative bounds are resolved again on every run of the same sequence.
+	tail := n.RangeByRank(-3, -2)
+	assert.Equal(t, []string{"m7", "m8"}, seqMembers(tail))
+	n.ZAdd(10, "m10")
+	assert.Equal(t, []string{"m8", "m9"}, seqMembers(tail))
+	assert.Equal(t, []string{"m8", "m9"}, seqMembers(tail))
+	n.ZRem("m10")
+
+	assert.Equal(t, []string{"m2", "m3", "m4", "m5"}, seqMembers(n.RangeByScore(1, 2)))
+	assert.Equal(t, []string{"m4", "m5"}, seqMembers(n.RangeByScore(1.5, 2.5)))
+	assert.Equal(t, all, seqMembers(n.RangeByScore(math.Inf(-1), math.Inf(1))))
+	assert.Empty(t, seqMembers(n.RangeByScore(3, 1)))
+
+	// Stops when the loop breaks.
+	var first []string
+	for member, score := range n.Backward() {
+		first = append(first, member)
+		assert.Equal(t, float64(4), score)
+		if len(first) == 2 {
+			break
+		}
+	}
+	assert.Equal(t, []string{"m9", "m8"}, first)
+
+	// The output can rebuild the set.
+	z, err := NewZSetFromSorted(n.All())
+	assert.NoError(t, err)
+	assert.Equal(t, all, seqMembers(z.All()))
+}
+
+func makeLexZSet() *ZSet {
+	n := NewZSet()
+	for _, member := range []string{"a", "b", "c", "d", "e", "f", "g"} {
+		n.ZAdd(0, member)
+	}
+	return n
+}
+
+func TestZSet_ZRangeByLex(t *testing.T) {
+	n := makeLexZSet()
+	for _, c := range []struct {
+		min, max string
+		members  []string
+	}{
+		{"-", "+", []string{"a", "b", "c", "d", "e", "f", "g"}},
+		{"-", "[c", []string{"a", "b", "c"}},
+		{"-", "(c", []string{"a", "b"}},
+		{"[aaa", "(g", []string{"b", "c", "d", "e", "f"}},
+		{"(a", "[b", []string{"b"}},
+		{"[bb", "[cc", []string{"c"}},
+		{"[e", "+", []string{"e", "f", "g"}},
+		{"[x", "+", []string{}},
+		{"[d", "[b", []string{}},
+		{"(c", "(c", []string{}},
+		{"+", "+", []string{}},
+		{"-", "-", []string{}},
+	} {
+		members, err := n.ZRangeByLex(c.min, c.max, 0, -1)
+		assert.NoError(t, err)
+		assert.Equal(t, c.members, members, "%s %s", c.min, c.max)
+
+		reversed := make([]string, len(c.members))
+		for i, member := range c.members {
+			reversed[len(c.members)-1-i] = member
+		}
+		members, err = n.ZRevRangeByLex(c.max, c.min, 0, -1)
+		assert.NoError(t, err)
+		assert.Equal(t, reversed, members, "%s %s", c.max, c.min)
+
+		count, err := n.ZLexCount(c.min, c.max)
+		assert.NoError(t, err)
+		assert.Equal(t, int64(len(c.members)), count, "%s %s", c.min, c.max)
+	}
+
+	members, err := n.ZRangeByLex("-", "+", 2, 3)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"c", "d", "e"}, members)
+	members, err = n.ZRevRangeByLex("+", "-", 5, 10)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"b", "a"}, members)
+	members, err = n.ZRangeByLex("-", "+", 0, 0)
+	assert.NoError(t, err)
+	assert.Empty(t, members)
+
+	for _, bound := range []string{"a", "", "]a"} {
+		_, err = n.ZRangeByLex(bound, "+", 0, -1)
+		assert.ErrorIs(t, err, ErrInvalidParams)
+		_, err = n.ZRevRangeByLex(bound, "-", 0, -1)
+		assert.ErrorIs(t, err, ErrInvalidParams)
+		_, err = n.ZLexCount("-", bound)
+		assert.ErrorIs(t, err, ErrInvalidParams)
+		_, err = n.ZRemRangeByLex("-", bound)
+		assert.ErrorIs(t, err, ErrInvalidParams)
+	}
+}
+
+func TestZSet_ZRemRangeByLex(t *testing.T) {
+	n := makeLexZSet()
+	removed, err := n.ZRemRangeByLex("(b", "[e")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(3), removed)
+	assert.Equal(t, []string{"a", "b", "f", "g"}, seqMembers(n.All()))
+	assert.NoError(t, n.Verify())
+	_, err = n.ZScore("c")
+	assert.ErrorIs(t, err, ErrKeyNotExist)
+
+	removed, err = n.ZRemRangeByLex("[x", "+")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(0), removed)
+
+	removed, err = n.ZRemRangeByLex("-", "+")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(4), removed)
 	assert.Equal(t, 0, n.ZCard())
+	assert.NoError(t, n.Verify())
+
+	// A larger set exercises deletions across several levels.
+	n = NewZSet()
+	for i := 0; i < 1000; i++ {
+		n.ZAdd(0, fmt.Sprintf("m%04d", i))
+	}
+	removed, err = n.ZRemRangeByLex("[m0100", "(m0900")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(800), removed)
+	assert.Equal(t, 200, n.ZCard())
+	assert.NoError(t, n.Verify())
+	count, err := n.ZLexCount("-", "+")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(200), count)
+}
+
+func TestZSet_ZRemRangeByRank(t *testing.T) {
+	for _, c := range []struct {
+		start, stop int
+		left        []string
+	}{
+		{0, 1, []string{"bcd", "acc", "mcd", "ccd", "ecd"}},
+		{-2, -1, []string{"ced", "acd", "bcd", "acc", "mcd"}},
+		{2, 4, []string{"ced", "acd", "ccd", "ecd"}},
+		{5, 100, []string{"ced", "acd", "bcd", "acc", "mcd"}},
+		{-100, 0, []string{"acd", "bcd", "acc", "mcd", "ccd", "ecd"}},
+		{0, -1, nil},
+		{4, 2, []string{"ced", "acd", "bcd", "acc", "mcd", "ccd", "ecd"}},
+		{7, 9, []string{"ced", "acd", "bcd", "acc", "mcd", "ccd", "ecd"}},
+	} {
+		n := makeZSet()
+		removed := n.ZRemRangeByRank(c.start, c.stop)
+		assert.Equal(t, int64(7-len(c.left)), removed, "%d %d", c.start, c.stop)
+		assert.Equal(t, c.left, seqMembers(n.All()), "%d %d", c.start, c.stop)
+		assert.NoError(t, n.Verify())
+	}
+
+	// Keep the top 100 of a larger set.
+	n := NewZSet()
+	for i := 0; i < 5000; i++ {
+		n.ZAdd(float64(i%1000), fmt.Sprintf("m%04d", i))
+	}
+	assert.Equal(t, int64(4900), n.ZRemRangeByRank(0, -101))
+	assert.Equal(t, 100, n.ZCard())
+	assert.NoError(t, n.Verify())
+	rank, err := n.ZRevRank("m4999")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(0), rank)
+	_, err = n.ZScore("m0000")
+	assert.ErrorIs(t, err, ErrKeyNotExist)
+}
+
+func TestZSet_ZRemRangeByScore(t *testing.T) {
+	n := makeZSet()
+	assert.Equal(t, int64(3), n.ZRemRangeByScore(2, 4))
+	assert.Equal(t, []string{"ced", "mcd", "ccd", "ecd"}, seqMembers(n.All()))
+	assert.Equal(t, int64(0), n.ZRemRangeByScore(2, 4))
+	assert.Equal(t, int64(0), n.ZRemRangeByScore(6, 5))
+	assert.Equal(t, int64(2), n.ZRemRangeByScore(5.5, math.Inf(1)))
+	assert.Equal(t, []string{"ced", "mcd"}, seqMembers(n.All()))
+	assert.NoError(t, n.Verify())
+
+	n = NewZSet()
+	for i := 0; i < 5000; i++ {
+		n.ZAdd(float64(i%1000), fmt.Sprintf("m%04d", i))
+	}
+	assert.Equal(t, int64(2500), n.ZRemRangeByScore(250, 749))
+	assert.Equal(t, int64(2500), n.ZCount(math.Inf(-1), math.Inf(1)))
+	assert.Equal(t, int64(0), n.ZCount(250, 749))
+	assert.NoError(t, n.Verify())
+}
+
+// zsetOf builds a set from alternating members and scores.
+func zsetOf(pairs ...any) *ZSet {
+	n := NewZSet()
+	for i := 0; i < len(pairs); i += 2 {
+		n.ZAdd(pairs[i+1].(float64), pairs[i].(string))
+	}
+	return n
+}
+
+func zsetScores(n *ZSet) map[string]float64 {
+	scores := make(map[string]float64)
+	for member, score := range n.All() {
+		scores[member] = score
+	}
+	return scores
+}
+
+func TestZSet_ZUnion(t *testing.T) {
+	a := zsetOf("x", 1.0, "y", 2.0)
+	b := zsetOf("y", 3.0, "z", 4.0)
+
+	u, err := ZUnion([]*ZSet{a, b}, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]float64{"x": 1, "y": 5, "z": 4}, zsetScores(u))
+	assert.Equal(t, []string{"x", "z", "y"}, seqMembers(u.All()))
+	assert.NoError(t, u.Verify())
+
+	u, err = ZUnion([]*ZSet{a, b}, &ZAggregateOptions{Weights: []float64{2, 10}, Aggregate: AggregateMin})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]float64{"x": 2, "y": 4, "z": 40}, zsetScores(u))
+	u, err = ZUnion([]*ZSet{a, b}, &ZAggregateOptions{Aggregate: AggregateMax})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]float64{"x": 1, "y": 3, "z": 4}, zsetScores(u))
+
+	// The inputs are left alone.
+	assert.Equal(t, map[string]float64{"x": 1, "y": 2}, zsetScores(a))
+
+	// NaN counts as 0, like in Redis.
+	inf := zsetOf("p", math.Inf(1), "q", math.Inf(-1))
+	u, err = ZUnion([]*ZSet{inf, zsetOf("p", math.Inf(-1))}, &ZAggregateOptions{Weights: []float64{0, 1}})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]float64{"p": math.Inf(-1), "q": 0}, zsetScores(u))
+	u, err = ZUnion([]*ZSet{inf, inf}, &ZAggregateOptions{Weights: []float64{1, -1}})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]float64{"p": 0, "q": 0}, zsetScores(u))
+
+	_, err = ZUnion(nil, nil)
+	assert.ErrorIs(t, err, ErrInvalidParams)
+	_, err = ZUnion([]*ZSet{a, b}, &ZAggregateOptions{Weights: []float64{1}})
+	assert.ErrorIs(t, err, ErrInvalidParams)
+	_, err = ZUnion([]*ZSet{a}, &ZAggregateOptions{Weights: []float64{math.NaN()}})
+	assert.ErrorIs(t, err, ErrInvalidParams)
+	_, err = ZUnion([]*ZSet{a}, &ZAggregateOptions{Aggregate: 3})
+	assert.ErrorIs(t, err, ErrInvalidParams)
+}
+
+func TestZSet_ZInter(t *testing.T) {
+	a := zsetOf("x", 1.0, "y", 2.0, "z", 3.0)
+	b := zsetOf("y", 10.0, "z", 20.0, "w", 30.0)
+	c := zsetOf("z", 100.0, "y", 200.0)
+
+	i, err := ZInter([]*ZSet{a, b, c}, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]float64{"y": 212, "z": 123}, zsetScores(i))
+	assert.Equal(t, []string{"z", "y"}, seqMembers(i.All()))
+
+	i, err = ZInter([]*ZSet{a, b}, &ZAggregateOptions{Weights: []float64{100, 1}, Aggregate: AggregateMax})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]float64{"y": 200, "z": 300}, zsetScores(i))
+	i, err = ZInter([]*ZSet{a, b}, &ZAggregateOptions{Aggregate: AggregateMin})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]float64{"y": 2, "z": 3}, zsetScores(i))
+
+	i, err = ZInter([]*ZSet{a, NewZSet()}, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, i.ZCard())
+	_, err = ZInter([]*ZSet{a, b}, &ZAggregateOptions{Weights: []float64{1, 2, 3}})
+	assert.ErrorIs(t, err, ErrInvalidParams)
+}
+
+func TestZSet_ZDiff(t *testing.T) {
+	a := makeZSet()
+	d, err := ZDiff([]*ZSet{a, zsetOf("ced", 0.0), zsetOf("mcd", 9.0, "nope", 1.0)})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"acd", "bcd", "acc", "ccd", "ecd"}, seqMembers(d.All()))
+	for member, score := range d.All() {
+		s, _ := a.ZScore(member)
+		assert.Equal(t, s, score)
+	}
+	assert.NoError(t, d.Verify())
+
+	d, err = ZDiff([]*ZSet{a})
+	assert.NoError(t, err)
+	assert.Equal(t, seqMembers(a.All()), seqMembers(d.All()))
+	d, err = ZDiff([]*ZSet{a, a})
+	assert.NoError(t, err)
+	assert.Equal(t, 0, d.ZCard())
+	_, err = ZDiff(nil)
+	assert.ErrorIs(t, err, ErrInvalidParams)
 }